@@ -0,0 +1,681 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/VuTLy/blogAggregator/internal/database"
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+//go:embed openapi.json
+var openAPISpec []byte
+
+const (
+	defaultPageSize = 20
+	maxPageSize     = 100
+)
+
+func handlerServe(s *state, cmd command) error {
+	fs := flag.NewFlagSet(cmd.Name, flag.ContinueOnError)
+	addr := fs.String("addr", ":8080", "address to listen on")
+	args, err := parseFlags(fs, cmd.Args)
+	if err != nil {
+		return err
+	}
+	if len(args) != 0 {
+		return fmt.Errorf("usage: %s [--addr host:port]", cmd.Name)
+	}
+
+	srv := &http.Server{
+		Addr:              *addr,
+		Handler:           newRouter(s),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- srv.ListenAndServe()
+	}()
+	log.Printf("Serving gator on %s", *addr)
+
+	select {
+	case err := <-serveErr:
+		return fmt.Errorf("couldn't serve: %w", err)
+	case <-ctx.Done():
+	}
+
+	log.Println("Shutting down, waiting for open requests to finish...")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	err = srv.Shutdown(shutdownCtx)
+	if err != nil {
+		return fmt.Errorf("couldn't shut down cleanly: %w", err)
+	}
+	return nil
+}
+
+type apiHandler func(s *state, w http.ResponseWriter, r *http.Request)
+
+// newRouter serves the JSON API under /v1, the Google Reader API for sync
+// clients, and the web UI everywhere else.
+func newRouter(s *state) http.Handler {
+	mux := http.NewServeMux()
+	handle := func(pattern string, handler apiHandler) {
+		mux.HandleFunc(pattern, func(w http.ResponseWriter, r *http.Request) {
+			handler(s, w, r)
+		})
+	}
+
+	handle("GET /v1/openapi.json", apiOpenAPISpec)
+	handle("GET /v1/users", apiListUsers)
+	handle("POST /v1/users", apiCreateUser)
+	handle("GET /v1/users/me", apiMiddlewareAuth(apiGetCurrentUser))
+	handle("GET /v1/feeds", apiListFeeds)
+	handle("GET /v1/feeds/{feedID}", apiGetFeed)
+	handle("POST /v1/feeds", apiMiddlewareAuth(apiCreateFeed))
+	handle("GET /v1/feed_follows", apiMiddlewareAuth(apiListFeedFollows))
+	handle("POST /v1/feed_follows", apiMiddlewareAuth(apiCreateFeedFollow))
+	handle("DELETE /v1/feed_follows/{feedID}", apiMiddlewareAuth(apiDeleteFeedFollow))
+	handle("GET /v1/posts", apiMiddlewareAuth(apiListPosts))
+	handle("GET /v1/timeline/{format}", apiMiddlewareFeedAuth(apiTimeline))
+
+	registerReaderRoutes(handle)
+	registerWebRoutes(handle)
+
+	return mux
+}
+
+// apiMiddlewareAuth is the API's middlewareLoggedIn: it resolves the user
+// from the API key in the Authorization header.
+func apiMiddlewareAuth(handler func(s *state, w http.ResponseWriter, r *http.Request, user database.User)) apiHandler {
+	return apiAuthenticate(handler, false)
+}
+
+// apiMiddlewareFeedAuth is apiMiddlewareAuth for documents meant for feed
+// readers, most of which can't set headers, so the key may also be given as
+// a key query parameter.
+func apiMiddlewareFeedAuth(handler func(s *state, w http.ResponseWriter, r *http.Request, user database.User)) apiHandler {
+	return apiAuthenticate(handler, true)
+}
+
+func apiAuthenticate(handler func(s *state, w http.ResponseWriter, r *http.Request, user database.User), allowQueryKey bool) apiHandler {
+	return func(s *state, w http.ResponseWriter, r *http.Request) {
+		key, err := bearerToken(r.Header)
+		if err != nil && allowQueryKey && r.URL.Query().Get("key") != "" {
+			key, err = r.URL.Query().Get("key"), nil
+		}
+		if err != nil {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="gator"`)
+			respondWithError(w, http.StatusUnauthorized, err.Error())
+			return
+		}
+
+		user, err := s.db.GetUserByAPIKey(r.Context(), hashAPIKey(key))
+		if errors.Is(err, sql.ErrNoRows) {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="gator", error="invalid_token"`)
+			respondWithError(w, http.StatusUnauthorized, "invalid or revoked API key")
+			return
+		}
+		if err != nil {
+			respondWithInternalError(w, "couldn't get user", err)
+			return
+		}
+
+		handler(s, w, r, user)
+	}
+}
+
+type apiUser struct {
+	ID        uuid.UUID `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	Name      string    `json:"name"`
+}
+
+func newAPIUser(user database.User) apiUser {
+	return apiUser{
+		ID:        user.ID,
+		CreatedAt: user.CreatedAt,
+		UpdatedAt: user.UpdatedAt,
+		Name:      user.Name,
+	}
+}
+
+type apiFeed struct {
+	ID                   uuid.UUID  `json:"id"`
+	CreatedAt            time.Time  `json:"created_at"`
+	UpdatedAt            time.Time  `json:"updated_at"`
+	Name                 string     `json:"name"`
+	URL                  string     `json:"url"`
+	UserID               uuid.UUID  `json:"user_id"`
+	LastFetchedAt        *time.Time `json:"last_fetched_at"`
+	NextFetchAt          *time.Time `json:"next_fetch_at"`
+	FetchIntervalSeconds int32      `json:"fetch_interval_seconds"`
+	LastSuccessAt        *time.Time `json:"last_success_at"`
+	LastError            *string    `json:"last_error"`
+	ConsecutiveFailures  int32      `json:"consecutive_failures"`
+	DisabledAt           *time.Time `json:"disabled_at"`
+}
+
+func newAPIFeed(feed database.Feed) apiFeed {
+	return apiFeed{
+		ID:                   feed.ID,
+		CreatedAt:            feed.CreatedAt,
+		UpdatedAt:            feed.UpdatedAt,
+		Name:                 feed.Name,
+		URL:                  feed.Url,
+		UserID:               feed.UserID,
+		LastFetchedAt:        nullTimePtr(feed.LastFetchedAt),
+		NextFetchAt:          nullTimePtr(feed.NextFetchAt),
+		FetchIntervalSeconds: feed.FetchIntervalSeconds,
+		LastSuccessAt:        nullTimePtr(feed.LastSuccessAt),
+		LastError:            nullStringPtr(feed.LastError),
+		ConsecutiveFailures:  feed.ConsecutiveFailures,
+		DisabledAt:           nullTimePtr(feed.DisabledAt),
+	}
+}
+
+type apiFeedFollow struct {
+	ID        uuid.UUID `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	UserID    uuid.UUID `json:"user_id"`
+	FeedID    uuid.UUID `json:"feed_id"`
+	FeedName  string    `json:"feed_name"`
+	FeedURL   string    `json:"feed_url,omitempty"`
+	Category  *string   `json:"category"`
+}
+
+type apiPost struct {
+	ID          uuid.UUID  `json:"id"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+	Title       string     `json:"title"`
+	URL         string     `json:"url"`
+	Description *string    `json:"description"`
+	PublishedAt *time.Time `json:"published_at"`
+	FeedID      uuid.UUID  `json:"feed_id"`
+	FeedName    string     `json:"feed_name"`
+}
+
+func newAPIPost(post database.GetPostsForUserRow) apiPost {
+	return apiPost{
+		ID:          post.ID,
+		CreatedAt:   post.CreatedAt,
+		UpdatedAt:   post.UpdatedAt,
+		Title:       post.Title,
+		URL:         post.Url,
+		Description: nullStringPtr(post.Description),
+		PublishedAt: nullTimePtr(post.PublishedAt),
+		FeedID:      post.FeedID,
+		FeedName:    post.FeedName,
+	}
+}
+
+// apiList is one page of a list endpoint. NextOffset is set when the page is
+// full, so there may be more items after it.
+type apiList[T any] struct {
+	Items      []T    `json:"items"`
+	Limit      int32  `json:"limit"`
+	Offset     int32  `json:"offset"`
+	NextOffset *int32 `json:"next_offset"`
+}
+
+func newAPIList[T any](items []T, limit, offset int32) apiList[T] {
+	list := apiList[T]{
+		Items:  items,
+		Limit:  limit,
+		Offset: offset,
+	}
+	if list.Items == nil {
+		list.Items = []T{}
+	}
+	if int32(len(items)) == limit {
+		next := offset + limit
+		list.NextOffset = &next
+	}
+	return list
+}
+
+func apiOpenAPISpec(s *state, w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(openAPISpec)
+}
+
+func apiListUsers(s *state, w http.ResponseWriter, r *http.Request) {
+	limit, offset, err := parsePage(r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	users, err := s.db.ListUsers(r.Context(), database.ListUsersParams{
+		Limit:  limit,
+		Offset: offset,
+	})
+	if err != nil {
+		respondWithInternalError(w, "couldn't get users", err)
+		return
+	}
+
+	items := make([]apiUser, 0, len(users))
+	for _, user := range users {
+		items = append(items, newAPIUser(user))
+	}
+	respondWithJSON(w, http.StatusOK, newAPIList(items, limit, offset))
+}
+
+func apiCreateUser(s *state, w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Name string `json:"name"`
+	}
+	if !decodeJSONBody(w, r, &body) {
+		return
+	}
+	body.Name = strings.TrimSpace(body.Name)
+	if body.Name == "" {
+		respondWithError(w, http.StatusBadRequest, "name is required")
+		return
+	}
+
+	user, err := s.db.CreateUser(r.Context(), database.CreateUserParams{
+		ID:        uuid.New(),
+		CreatedAt: time.Now().UTC(),
+		UpdatedAt: time.Now().UTC(),
+		Name:      body.Name,
+	})
+	if isUniqueViolation(err) {
+		respondWithError(w, http.StatusConflict, "a user with that name already exists")
+		return
+	}
+	if err != nil {
+		respondWithInternalError(w, "couldn't create user", err)
+		return
+	}
+
+	// The new user has no other way to authenticate, so they get a first
+	// key along with their account.
+	key, _, err := createAPIKey(r.Context(), s.db, user, "default")
+	if err != nil {
+		respondWithInternalError(w, "couldn't create API key", err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusCreated, struct {
+		apiUser
+		APIKey string `json:"api_key"`
+	}{
+		apiUser: newAPIUser(user),
+		APIKey:  key,
+	})
+}
+
+func apiGetCurrentUser(s *state, w http.ResponseWriter, r *http.Request, user database.User) {
+	respondWithJSON(w, http.StatusOK, newAPIUser(user))
+}
+
+func apiListFeeds(s *state, w http.ResponseWriter, r *http.Request) {
+	limit, offset, err := parsePage(r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	feeds, err := s.db.ListFeeds(r.Context(), database.ListFeedsParams{
+		Limit:  limit,
+		Offset: offset,
+	})
+	if err != nil {
+		respondWithInternalError(w, "couldn't get feeds", err)
+		return
+	}
+
+	items := make([]apiFeed, 0, len(feeds))
+	for _, feed := range feeds {
+		items = append(items, newAPIFeed(feed))
+	}
+	respondWithJSON(w, http.StatusOK, newAPIList(items, limit, offset))
+}
+
+func apiGetFeed(s *state, w http.ResponseWriter, r *http.Request) {
+	feedID, err := uuid.Parse(r.PathValue("feedID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "invalid feed ID")
+		return
+	}
+
+	feed, err := s.db.GetFeedByID(r.Context(), feedID)
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithError(w, http.StatusNotFound, "feed not found")
+		return
+	}
+	if err != nil {
+		respondWithInternalError(w, "couldn't get feed", err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, newAPIFeed(feed))
+}
+
+func apiCreateFeed(s *state, w http.ResponseWriter, r *http.Request, user database.User) {
+	var body struct {
+		Name string `json:"name"`
+		URL  string `json:"url"`
+	}
+	if !decodeJSONBody(w, r, &body) {
+		return
+	}
+	if strings.TrimSpace(body.Name) == "" || strings.TrimSpace(body.URL) == "" {
+		respondWithError(w, http.StatusBadRequest, "name and url are required")
+		return
+	}
+
+	// Unlike the CLI there's nobody to ask when a site has several feeds, so
+	// the first one it advertises is used.
+	candidates, err := discoverFeeds(r.Context(), publicHTTPClient, strings.TrimSpace(body.URL))
+	if err != nil {
+		respondWithError(w, http.StatusUnprocessableEntity, fmt.Sprintf("couldn't find a feed at %s: %v", body.URL, err))
+		return
+	}
+
+	feed, feedFollow, err := addFeed(r.Context(), s.db, user, strings.TrimSpace(body.Name), candidates[0].URL, true)
+	if isUniqueViolation(err) {
+		respondWithError(w, http.StatusConflict, "that feed has already been added")
+		return
+	}
+	if err != nil {
+		respondWithInternalError(w, "couldn't add feed", err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusCreated, struct {
+		Feed       apiFeed       `json:"feed"`
+		FeedFollow apiFeedFollow `json:"feed_follow"`
+	}{
+		Feed: newAPIFeed(feed),
+		FeedFollow: apiFeedFollow{
+			ID:        feedFollow.ID,
+			CreatedAt: feedFollow.CreatedAt,
+			UpdatedAt: feedFollow.UpdatedAt,
+			UserID:    feedFollow.UserID,
+			FeedID:    feedFollow.FeedID,
+			FeedName:  feedFollow.FeedName,
+			FeedURL:   feed.Url,
+			Category:  nullStringPtr(feedFollow.Category),
+		},
+	})
+}
+
+// apiListFeedFollows pages through the user's follows in memory, since
+// GetFeedFollowsForUser returns them all and a user follows few feeds.
+func apiListFeedFollows(s *state, w http.ResponseWriter, r *http.Request, user database.User) {
+	limit, offset, err := parsePage(r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	feedFollows, err := s.db.GetFeedFollowsForUser(r.Context(), user.ID)
+	if err != nil {
+		respondWithInternalError(w, "couldn't get feed follows", err)
+		return
+	}
+
+	start := min(int(offset), len(feedFollows))
+	end := min(start+int(limit), len(feedFollows))
+	items := make([]apiFeedFollow, 0, end-start)
+	for _, ff := range feedFollows[start:end] {
+		items = append(items, apiFeedFollow{
+			ID:        ff.ID,
+			CreatedAt: ff.CreatedAt,
+			UpdatedAt: ff.UpdatedAt,
+			UserID:    ff.UserID,
+			FeedID:    ff.FeedID,
+			FeedName:  ff.FeedName,
+			FeedURL:   ff.FeedUrl,
+			Category:  nullStringPtr(ff.Category),
+		})
+	}
+	respondWithJSON(w, http.StatusOK, newAPIList(items, limit, offset))
+}
+
+func apiCreateFeedFollow(s *state, w http.ResponseWriter, r *http.Request, user database.User) {
+	var body struct {
+		FeedID  uuid.UUID `json:"feed_id"`
+		FeedURL string    `json:"feed_url"`
+	}
+	if !decodeJSONBody(w, r, &body) {
+		return
+	}
+
+	var feed database.Feed
+	var err error
+	switch {
+	case body.FeedID != uuid.Nil:
+		feed, err = s.db.GetFeedByID(r.Context(), body.FeedID)
+	case body.FeedURL != "":
+		feed, err = s.db.GetFeedByURL(r.Context(), body.FeedURL)
+	default:
+		respondWithError(w, http.StatusBadRequest, "feed_id or feed_url is required")
+		return
+	}
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithError(w, http.StatusNotFound, "feed not found")
+		return
+	}
+	if err != nil {
+		respondWithInternalError(w, "couldn't get feed", err)
+		return
+	}
+
+	ff, err := s.db.CreateFeedFollow(r.Context(), database.CreateFeedFollowParams{
+		ID:        uuid.New(),
+		CreatedAt: time.Now().UTC(),
+		UpdatedAt: time.Now().UTC(),
+		UserID:    user.ID,
+		FeedID:    feed.ID,
+	})
+	if isUniqueViolation(err) {
+		respondWithError(w, http.StatusConflict, "already following that feed")
+		return
+	}
+	if err != nil {
+		respondWithInternalError(w, "couldn't create feed follow", err)
+		return
+	}
+	_, err = hideMatchingPosts(r.Context(), s.db, user, uuid.NullUUID{UUID: feed.ID, Valid: true})
+	if err != nil {
+		respondWithInternalError(w, "couldn't apply hide rules", err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusCreated, apiFeedFollow{
+		ID:        ff.ID,
+		CreatedAt: ff.CreatedAt,
+		UpdatedAt: ff.UpdatedAt,
+		UserID:    ff.UserID,
+		FeedID:    ff.FeedID,
+		FeedName:  ff.FeedName,
+		FeedURL:   feed.Url,
+		Category:  nullStringPtr(ff.Category),
+	})
+}
+
+func apiDeleteFeedFollow(s *state, w http.ResponseWriter, r *http.Request, user database.User) {
+	feedID, err := uuid.Parse(r.PathValue("feedID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "invalid feed ID")
+		return
+	}
+
+	count, err := s.db.DeleteFeedFollow(r.Context(), database.DeleteFeedFollowParams{
+		FeedID: feedID,
+		UserID: user.ID,
+	})
+	if err != nil {
+		respondWithInternalError(w, "couldn't delete feed follow", err)
+		return
+	}
+	if count == 0 {
+		respondWithError(w, http.StatusNotFound, "not following that feed")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func apiListPosts(s *state, w http.ResponseWriter, r *http.Request, user database.User) {
+	limit, offset, err := parsePage(r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	query := r.URL.Query()
+	order := query.Get("order")
+	if order == "" {
+		order = "desc"
+	}
+	if order != "asc" && order != "desc" {
+		respondWithError(w, http.StatusBadRequest, "order must be asc or desc")
+		return
+	}
+
+	params := database.GetFilteredPostsForUserParams{
+		UserID:      user.ID,
+		IncludeRead: query.Get("all") == "true",
+		OldestFirst: order == "asc",
+		MaxPosts:    limit,
+		SkipPosts:   offset,
+	}
+	if value := query.Get("feed_id"); value != "" {
+		feedID, err := uuid.Parse(value)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, "invalid feed_id")
+			return
+		}
+		params.FeedID = uuid.NullUUID{
+			UUID:  feedID,
+			Valid: true,
+		}
+	}
+	if params.Since, err = parseTimeFilter(query.Get("since")); err != nil {
+		respondWithError(w, http.StatusBadRequest, "invalid since: "+err.Error())
+		return
+	}
+	if params.Until, err = parseTimeFilter(query.Get("until")); err != nil {
+		respondWithError(w, http.StatusBadRequest, "invalid until: "+err.Error())
+		return
+	}
+
+	rows, err := s.db.GetFilteredPostsForUser(r.Context(), params)
+	if err != nil {
+		respondWithInternalError(w, "couldn't get posts", err)
+		return
+	}
+
+	items := make([]apiPost, 0, len(rows))
+	for _, row := range rows {
+		items = append(items, newAPIPost(database.GetPostsForUserRow(row)))
+	}
+	respondWithJSON(w, http.StatusOK, newAPIList(items, limit, offset))
+}
+
+// parsePage reads the limit and offset query parameters.
+func parsePage(r *http.Request) (limit, offset int32, err error) {
+	limit, offset = defaultPageSize, 0
+	query := r.URL.Query()
+	if value := query.Get("limit"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 || n > maxPageSize {
+			return 0, 0, fmt.Errorf("limit must be between 1 and %d", maxPageSize)
+		}
+		limit = int32(n)
+	}
+	if value := query.Get("offset"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 0 {
+			return 0, 0, errors.New("offset must be a non-negative integer")
+		}
+		offset = int32(n)
+	}
+	return limit, offset, nil
+}
+
+// decodeJSONBody decodes the request body into v, responding with 400 and
+// returning false if it isn't valid JSON.
+func decodeJSONBody(w http.ResponseWriter, r *http.Request, v any) bool {
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(v); err != nil {
+		respondWithError(w, http.StatusBadRequest, fmt.Sprintf("invalid request body: %v", err))
+		return false
+	}
+	return true
+}
+
+func respondWithJSON(w http.ResponseWriter, code int, payload any) {
+	dat, err := json.Marshal(payload)
+	if err != nil {
+		log.Printf("Couldn't encode response: %v", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	w.Write(dat)
+}
+
+func respondWithError(w http.ResponseWriter, code int, msg string) {
+	respondWithJSON(w, code, struct {
+		Error string `json:"error"`
+	}{
+		Error: msg,
+	})
+}
+
+// respondWithInternalError logs err and responds with a 500 that doesn't
+// leak database details to the client.
+func respondWithInternalError(w http.ResponseWriter, msg string, err error) {
+	log.Printf("%s: %v", msg, err)
+	respondWithError(w, http.StatusInternalServerError, msg)
+}
+
+// isUniqueViolation reports whether err is a Postgres unique constraint
+// violation, such as a duplicate user name or feed URL.
+func isUniqueViolation(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23505"
+}
+
+func nullTimePtr(t sql.NullTime) *time.Time {
+	if !t.Valid {
+		return nil
+	}
+	return &t.Time
+}
+
+func nullStringPtr(s sql.NullString) *string {
+	if !s.Valid {
+		return nil
+	}
+	return &s.String
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/VuTLy/blogAggregator/internal/config"
+	"github.com/VuTLy/blogAggregator/internal/database"
+	"github.com/google/uuid"
+)
+
+// newTestAPI returns the serve router on a fresh test database, a user, and
+// an API key for them.
+func newTestAPI(t *testing.T) (http.Handler, *database.Queries, database.User, string) {
+	t.Helper()
+	_, queries := testDB(t)
+	user := createTestUser(t, queries, "alice")
+	key, _, err := createAPIKey(context.Background(), queries, user, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return newRouter(&state{db: queries, cfg: &config.Config{}}), queries, user, key
+}
+
+func apiRequest(t *testing.T, router http.Handler, method, path, key string, body io.Reader) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(method, path, body)
+	if key != "" {
+		req.Header.Set("Authorization", "Bearer "+key)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestAPIDeleteFeedFollow(t *testing.T) {
+	router, queries, user, key := newTestAPI(t)
+	feed := createTestFeed(t, queries, user, "https://example.com/feed.xml")
+	_, err := queries.CreateFeedFollow(context.Background(), database.CreateFeedFollowParams{
+		ID:        uuid.New(),
+		CreatedAt: time.Now().UTC(),
+		UpdatedAt: time.Now().UTC(),
+		UserID:    user.ID,
+		FeedID:    feed.ID,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i, want := range []int{http.StatusNoContent, http.StatusNotFound} {
+		rec := apiRequest(t, router, "DELETE", "/v1/feed_follows/"+feed.ID.String(), key, nil)
+		if rec.Code != want {
+			t.Errorf("delete %d: status %d, want %d: %s", i, rec.Code, want, rec.Body)
+		}
+	}
+	rec := apiRequest(t, router, "DELETE", "/v1/feed_follows/"+uuid.NewString(), key, nil)
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("deleting a follow of an unknown feed: status %d, want %d", rec.Code, http.StatusNotFound)
+	}
+}
+
+func TestAPICreateFeedRefusesPrivateAddresses(t *testing.T) {
+	router, _, _, key := newTestAPI(t)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("the API fetched %s from a local server", r.URL)
+	}))
+	defer server.Close()
+
+	for _, target := range []string{server.URL, "http://169.254.169.254/latest/meta-data/", "http://[::1]:8080/feed"} {
+		body, _ := json.Marshal(map[string]string{"name": "Internal", "url": target})
+		rec := apiRequest(t, router, "POST", "/v1/feeds", key, strings.NewReader(string(body)))
+		if rec.Code != http.StatusUnprocessableEntity {
+			t.Errorf("POST /v1/feeds %s: status %d, want %d", target, rec.Code, http.StatusUnprocessableEntity)
+		}
+		if !strings.Contains(rec.Body.String(), errPrivateAddress.Error()) {
+			t.Errorf("POST /v1/feeds %s: body %s, want it to mention %q", target, rec.Body, errPrivateAddress)
+		}
+	}
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/VuTLy/blogAggregator/internal/database"
+	"github.com/google/uuid"
+)
+
+// apiKeyPrefix marks gator keys so they're easy to spot in configs and logs.
+const apiKeyPrefix = "gator_"
+
+func handlerAPIKey(s *state, cmd command, user database.User) error {
+	usage := fmt.Errorf("usage: %s create <name> [--save] | list | revoke <prefix|name>", cmd.Name)
+	if len(cmd.Args) == 0 {
+		return usage
+	}
+
+	sub := command{Name: cmd.Name + " " + cmd.Args[0], Args: cmd.Args[1:]}
+	switch cmd.Args[0] {
+	case "create":
+		return handlerAPIKeyCreate(s, sub, user)
+	case "list":
+		return handlerAPIKeyList(s, sub, user)
+	case "revoke":
+		return handlerAPIKeyRevoke(s, sub, user)
+	default:
+		return usage
+	}
+}
+
+func handlerAPIKeyCreate(s *state, cmd command, user database.User) error {
+	fs := flag.NewFlagSet(cmd.Name, flag.ContinueOnError)
+	save := fs.Bool("save", false, "save the key in the config file and use it for the CLI")
+	args, err := parseFlags(fs, cmd.Args)
+	if err != nil {
+		return err
+	}
+	if len(args) != 1 {
+		return fmt.Errorf("usage: %s <name> [--save]", cmd.Name)
+	}
+
+	key, apiKey, err := createAPIKey(context.Background(), s.db, user, args[0])
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Created API key %s (%s) for %s:\n", apiKey.Name, apiKey.Prefix, user.Name)
+	fmt.Printf("    %s\n", key)
+	fmt.Println("This is the only time the key is shown, so store it somewhere safe.")
+
+	if *save {
+		err = s.cfg.SetAPIKey(key)
+		if err != nil {
+			return fmt.Errorf("couldn't save API key: %w", err)
+		}
+		fmt.Println("Saved the key to the config file; gator commands now authenticate with it.")
+	}
+	return nil
+}
+
+func handlerAPIKeyList(s *state, cmd command, user database.User) error {
+	if len(cmd.Args) != 0 {
+		return fmt.Errorf("usage: %s", cmd.Name)
+	}
+
+	keys, err := s.db.GetAPIKeysForUser(context.Background(), user.ID)
+	if err != nil {
+		return fmt.Errorf("couldn't get API keys: %w", err)
+	}
+
+	if len(keys) == 0 {
+		fmt.Println("No API keys found.")
+		return nil
+	}
+
+	fmt.Printf("Found %d API keys for %s:\n", len(keys), user.Name)
+	for _, key := range keys {
+		status := "active"
+		if key.RevokedAt.Valid {
+			status = fmt.Sprintf("revoked %v", key.RevokedAt.Time.Format(time.DateTime))
+		}
+		lastUsed := "never"
+		if key.LastUsedAt.Valid {
+			lastUsed = key.LastUsedAt.Time.Format(time.DateTime)
+		}
+		fmt.Printf("* %s  %-20s created %v, last used %s, %s\n", key.Prefix, key.Name, key.CreatedAt.Format(time.DateTime), lastUsed, status)
+	}
+	return nil
+}
+
+func handlerAPIKeyRevoke(s *state, cmd command, user database.User) error {
+	if len(cmd.Args) != 1 {
+		return fmt.Errorf("usage: %s <prefix|name>", cmd.Name)
+	}
+
+	count, err := s.db.RevokeAPIKey(context.Background(), database.RevokeAPIKeyParams{
+		UserID: user.ID,
+		Key:    cmd.Args[0],
+	})
+	if err != nil {
+		return fmt.Errorf("couldn't revoke API key: %w", err)
+	}
+	if count == 0 {
+		return fmt.Errorf("no active API key matches %s", cmd.Args[0])
+	}
+
+	fmt.Printf("Revoked %d API keys.\n", count)
+	return nil
+}
+
+// createAPIKey generates a new key for user and stores its hash. The key
+// itself is only ever returned here.
+func createAPIKey(ctx context.Context, db *database.Queries, user database.User, name string) (string, database.ApiKey, error) {
+	secret := make([]byte, 32)
+	_, err := rand.Read(secret)
+	if err != nil {
+		return "", database.ApiKey{}, fmt.Errorf("couldn't generate API key: %w", err)
+	}
+	key := apiKeyPrefix + hex.EncodeToString(secret)
+
+	apiKey, err := db.CreateAPIKey(ctx, database.CreateAPIKeyParams{
+		ID:        uuid.New(),
+		CreatedAt: time.Now().UTC(),
+		UserID:    user.ID,
+		Name:      name,
+		Prefix:    key[:len(apiKeyPrefix)+8],
+		KeyHash:   hashAPIKey(key),
+	})
+	if err != nil {
+		return "", database.ApiKey{}, fmt.Errorf("couldn't create API key: %w", err)
+	}
+	return key, apiKey, nil
+}
+
+// hashAPIKey is what's stored for a key. Keys are 256 random bits, so a plain
+// SHA-256 is enough to keep a leaked database from yielding usable keys.
+func hashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// bearerToken extracts the key from an "Authorization: Bearer <key>" or
+// "Authorization: ApiKey <key>" header.
+func bearerToken(header http.Header) (string, error) {
+	scheme, token, ok := strings.Cut(strings.TrimSpace(header.Get("Authorization")), " ")
+	if !ok {
+		return "", errors.New("missing or malformed Authorization header")
+	}
+	if !strings.EqualFold(scheme, "Bearer") && !strings.EqualFold(scheme, "ApiKey") {
+		return "", fmt.Errorf("unsupported authorization scheme %q", scheme)
+	}
+	token = strings.TrimSpace(token)
+	if token == "" {
+		return "", errors.New("missing API key")
+	}
+	return token, nil
+}
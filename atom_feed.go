@@ -0,0 +1,130 @@
+package main
+
+import (
+	"encoding/xml"
+	"strings"
+)
+
+const atomNamespace = "http://www.w3.org/2005/Atom"
+
+type AtomFeed struct {
+	XMLName  xml.Name     `xml:"http://www.w3.org/2005/Atom feed"`
+	Title    AtomText     `xml:"title"`
+	Subtitle AtomText     `xml:"subtitle"`
+	Link     []AtomLink   `xml:"link"`
+	Author   []AtomPerson `xml:"author"`
+	Entry    []AtomEntry  `xml:"entry"`
+}
+
+type AtomEntry struct {
+	ID        string       `xml:"id"`
+	Title     AtomText     `xml:"title"`
+	Link      []AtomLink   `xml:"link"`
+	Summary   AtomText     `xml:"summary"`
+	Content   AtomText     `xml:"content"`
+	Published string       `xml:"published"`
+	Updated   string       `xml:"updated"`
+	Author    []AtomPerson `xml:"author"`
+}
+
+type AtomPerson struct {
+	Name string `xml:"name"`
+}
+
+type AtomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr"`
+	Type string `xml:"type,attr"`
+}
+
+// AtomText is an Atom text construct. Text and html content arrive as
+// character data, while xhtml content is kept as the raw inner markup.
+type AtomText struct {
+	Type  string `xml:"type,attr"`
+	Text  string `xml:",chardata"`
+	Inner string `xml:",innerxml"`
+}
+
+func (t AtomText) String() string {
+	if t.Type == "xhtml" {
+		return strings.TrimSpace(t.Inner)
+	}
+	return strings.TrimSpace(t.Text)
+}
+
+type atomFeedFormat struct{}
+
+func (atomFeedFormat) matches(root xml.Name, dat []byte) bool {
+	return root.Space == atomNamespace && root.Local == "feed"
+}
+
+func (atomFeedFormat) parse(dat []byte) (*RSSFeed, error) {
+	var atomFeed AtomFeed
+	err := xml.Unmarshal(dat, &atomFeed)
+	if err != nil {
+		return nil, err
+	}
+	return atomFeed.toRSSFeed(), nil
+}
+
+// toRSSFeed maps an Atom document onto the RSS model that scrapeFeed stores.
+func (f *AtomFeed) toRSSFeed() *RSSFeed {
+	rssFeed := &RSSFeed{}
+	rssFeed.Channel.Title = f.Title.String()
+	rssFeed.Channel.Link = alternateLink(f.Link)
+	rssFeed.Channel.Description = f.Subtitle.String()
+
+	for _, entry := range f.Entry {
+		description := entry.Summary.String()
+		if description == "" {
+			description = entry.Content.String()
+		}
+
+		// Entries without an author inherit the feed's.
+		authors := entry.Author
+		if len(authors) == 0 {
+			authors = f.Author
+		}
+
+		rssFeed.Channel.Item = append(rssFeed.Channel.Item, RSSItem{
+			Title:       entry.Title.String(),
+			Link:        alternateLink(entry.Link),
+			Description: description,
+			PubDate:     entry.Published,
+			GUID:        strings.TrimSpace(entry.ID),
+			Updated:     entry.Updated,
+			DCCreator:   atomPersonNames(authors),
+		})
+	}
+
+	return rssFeed
+}
+
+// atomPersonNames joins the names of an entry's authors.
+func atomPersonNames(people []AtomPerson) string {
+	var names []string
+	for _, person := range people {
+		if name := strings.TrimSpace(person.Name); name != "" {
+			names = append(names, name)
+		}
+	}
+	return strings.Join(names, ", ")
+}
+
+// alternateLink picks the rel="alternate" link, preferring an HTML one.
+// A link without a rel attribute is an alternate link per RFC 4287.
+func alternateLink(links []AtomLink) string {
+	href := ""
+	for _, link := range links {
+		if link.Rel != "" && link.Rel != "alternate" {
+			continue
+		}
+		if link.Type == "" || link.Type == "text/html" {
+			return link.Href
+		}
+		if href == "" {
+			href = link.Href
+		}
+	}
+	return href
+}
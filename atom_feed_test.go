@@ -0,0 +1,109 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func readFixture(t *testing.T, name string) []byte {
+	t.Helper()
+	dat, err := os.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatalf("couldn't read fixture: %v", err)
+	}
+	return dat
+}
+
+func TestParseAtomFeed(t *testing.T) {
+	feed, err := parseFeed(readFixture(t, "atom/blog.xml"))
+	if err != nil {
+		t.Fatalf("parseFeed: %v", err)
+	}
+
+	if got, want := feed.Channel.Title, "Example Blog"; got != want {
+		t.Errorf("title = %q, want %q", got, want)
+	}
+	if got, want := feed.Channel.Link, "https://blog.example.com/"; got != want {
+		t.Errorf("link = %q, want %q", got, want)
+	}
+	if got, want := feed.Channel.Description, "Notes & essays"; got != want {
+		t.Errorf("description = %q, want %q", got, want)
+	}
+
+	want := []RSSItem{
+		{
+			Title:       "Second post",
+			Link:        "https://blog.example.com/posts/second",
+			Description: "<p>A short <em>summary</em>.</p>",
+			PubDate:     "2024-03-02T10:00:00Z",
+			GUID:        "tag:blog.example.com,2024:second",
+			Updated:     "2024-03-02T11:30:00+01:00",
+			DCCreator:   "John Roe, Jane Doe",
+		},
+		{
+			Title:       `<div xmlns="http://www.w3.org/1999/xhtml">First <b>post</b></div>`,
+			Link:        "https://blog.example.com/posts/first",
+			Description: `<div xmlns="http://www.w3.org/1999/xhtml"><p>Hello, world.</p></div>`,
+			GUID:        "tag:blog.example.com,2024:first",
+			Updated:     "2024-03-01T09:00:00Z",
+			DCCreator:   "Jane Doe",
+		},
+	}
+	if len(feed.Channel.Item) != len(want) {
+		t.Fatalf("got %d items, want %d", len(feed.Channel.Item), len(want))
+	}
+	for i, item := range feed.Channel.Item {
+		if item != want[i] {
+			t.Errorf("item %d = %+v\nwant %+v", i, item, want[i])
+		}
+	}
+}
+
+func TestParseAtomFeedDates(t *testing.T) {
+	feed, err := parseFeed(readFixture(t, "atom/blog.xml"))
+	if err != nil {
+		t.Fatalf("parseFeed: %v", err)
+	}
+
+	// Entries without <published> fall back to <updated>.
+	for i, want := range []string{"2024-03-02T10:00:00Z", "2024-03-01T09:00:00Z"} {
+		got, ok := itemDate(feed.Channel.Item[i])
+		if !ok || got.Format(time.RFC3339) != want {
+			t.Errorf("item %d published at %s, want %s", i, got, want)
+		}
+	}
+}
+
+func TestParseAtomFeedAlternateLinks(t *testing.T) {
+	feed, err := parseFeed(readFixture(t, "atom/alternates.xml"))
+	if err != nil {
+		t.Fatalf("parseFeed: %v", err)
+	}
+
+	// An HTML (or untyped) alternate link wins over other types, and any
+	// alternate beats none. Enclosures are never the post's link.
+	if got, want := feed.Channel.Link, "https://cast.example.com/"; got != want {
+		t.Errorf("feed link = %q, want %q", got, want)
+	}
+	for i, want := range []string{"https://cast.example.com/ep1.xhtml", ""} {
+		if got := feed.Channel.Item[i].Link; got != want {
+			t.Errorf("item %d link = %q, want %q", i, got, want)
+		}
+	}
+	// Without a link, the id still identifies the entry.
+	if got, want := itemGUID(feed.Channel.Item[1]), "https://cast.example.com/ep2"; got != want {
+		t.Errorf("item 1 guid = %q, want %q", got, want)
+	}
+}
+
+func TestParseAtomFeedSniffsRoot(t *testing.T) {
+	// Only the root element decides, so a <feed> outside the Atom namespace
+	// isn't Atom.
+	_, err := parseFeed(readFixture(t, "atom/not_atom.xml"))
+	if !errors.Is(err, errUnknownFeedFormat) {
+		t.Errorf("feed outside the Atom namespace: err = %v, want %v", err, errUnknownFeedFormat)
+	}
+}
@@ -1,6 +1,9 @@
 package main
 
-import "errors"
+import (
+	"errors"
+	"flag"
+)
 
 type command struct {
 	Name string
@@ -22,3 +25,20 @@ func (c *commands) run(s *state, cmd command) error {
 	}
 	return f(s, cmd)
 }
+
+// parseFlags parses args with fs, allowing flags and positional arguments to
+// be interleaved, and returns the positional arguments in order.
+func parseFlags(fs *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		args = fs.Args()
+		if len(args) == 0 {
+			return positional, nil
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+}
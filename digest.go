@@ -0,0 +1,503 @@
+package main
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"database/sql"
+	"embed"
+	"errors"
+	"flag"
+	"fmt"
+	htmltemplate "html/template"
+	"log"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"slices"
+	"strconv"
+	texttemplate "text/template"
+	"time"
+
+	"github.com/VuTLy/blogAggregator/internal/config"
+	"github.com/VuTLy/blogAggregator/internal/database"
+	"github.com/google/uuid"
+)
+
+// maxDigestPosts caps how many posts one digest email lists.
+const maxDigestPosts = 200
+
+//go:embed templates/digest.html templates/digest.txt
+var digestFS embed.FS
+
+var (
+	digestHTML = htmltemplate.Must(htmltemplate.New("digest.html").Funcs(htmltemplate.FuncMap{
+		"date":    formatWebDate,
+		"excerpt": excerpt,
+	}).ParseFS(digestFS, "templates/digest.html"))
+	digestText = texttemplate.Must(texttemplate.New("digest.txt").Funcs(texttemplate.FuncMap{
+		"date": formatWebDate,
+	}).ParseFS(digestFS, "templates/digest.txt"))
+)
+
+// digestPeriods are the frequencies a user can subscribe to and how far
+// apart their digests are.
+var digestPeriods = map[string]time.Duration{
+	"daily":  24 * time.Hour,
+	"weekly": 7 * 24 * time.Hour,
+}
+
+// digestRecipient is a digest subscription along with when its last digest
+// ended.
+type digestRecipient struct {
+	UserID        uuid.UUID
+	UserName      string
+	Email         string
+	Frequency     string
+	LastWindowEnd sql.NullTime
+}
+
+// digest is what one digest email is rendered from: the unread posts that
+// arrived in the window, grouped by feed.
+type digest struct {
+	Subject     string
+	Frequency   string
+	SentAt      time.Time
+	WindowStart time.Time
+	WindowEnd   time.Time
+	Feeds       []digestFeed
+	PostCount   int
+	Truncated   bool
+}
+
+type digestFeed struct {
+	Name  string
+	URL   string
+	Posts []database.GetDigestPostsRow
+}
+
+func handlerDigest(s *state, cmd command, user database.User) error {
+	usage := fmt.Errorf("usage: %s subscribe <email> [--frequency daily|weekly] | unsubscribe | send [--dry-run] | run | history [--limit n]", cmd.Name)
+	if len(cmd.Args) == 0 {
+		return usage
+	}
+
+	sub := command{Name: cmd.Name + " " + cmd.Args[0], Args: cmd.Args[1:]}
+	switch cmd.Args[0] {
+	case "subscribe":
+		return handlerDigestSubscribe(s, sub, user)
+	case "unsubscribe":
+		return handlerDigestUnsubscribe(s, sub, user)
+	case "send":
+		return handlerDigestSend(s, sub, user)
+	case "run":
+		return handlerDigestRun(s, sub)
+	case "history":
+		return handlerDigestHistory(s, sub, user)
+	default:
+		return usage
+	}
+}
+
+func handlerDigestSubscribe(s *state, cmd command, user database.User) error {
+	fs := flag.NewFlagSet(cmd.Name, flag.ContinueOnError)
+	frequency := fs.String("frequency", "daily", "how often to send the digest: daily or weekly")
+	args, err := parseFlags(fs, cmd.Args)
+	if err != nil {
+		return err
+	}
+	if len(args) != 1 {
+		return fmt.Errorf("usage: %s <email> [--frequency daily|weekly]", cmd.Name)
+	}
+	if _, ok := digestPeriods[*frequency]; !ok {
+		return fmt.Errorf("unknown frequency %q: must be daily or weekly", *frequency)
+	}
+
+	address, err := mail.ParseAddress(args[0])
+	if err != nil {
+		return fmt.Errorf("invalid email address %q: %w", args[0], err)
+	}
+
+	subscription, err := s.db.UpsertDigestSubscription(context.Background(), database.UpsertDigestSubscriptionParams{
+		UserID:    user.ID,
+		CreatedAt: time.Now().UTC(),
+		UpdatedAt: time.Now().UTC(),
+		Email:     address.Address,
+		Frequency: *frequency,
+	})
+	if err != nil {
+		return fmt.Errorf("couldn't save digest subscription: %w", err)
+	}
+
+	fmt.Printf("%s will get a %s digest of new posts at %s.\n", user.Name, subscription.Frequency, subscription.Email)
+	if s.cfg.SMTPHost == "" {
+		fmt.Println("No SMTP server is configured yet: set smtp_host and smtp_from in the config file before digests can be sent.")
+	}
+	return nil
+}
+
+func handlerDigestUnsubscribe(s *state, cmd command, user database.User) error {
+	if len(cmd.Args) != 0 {
+		return fmt.Errorf("usage: %s", cmd.Name)
+	}
+
+	count, err := s.db.DeleteDigestSubscription(context.Background(), user.ID)
+	if err != nil {
+		return fmt.Errorf("couldn't remove digest subscription: %w", err)
+	}
+	if count == 0 {
+		return fmt.Errorf("%s isn't subscribed to digests", user.Name)
+	}
+
+	fmt.Printf("%s won't get digests anymore.\n", user.Name)
+	return nil
+}
+
+// handlerDigestSend sends the current user's digest straight away, whether
+// or not it's due. With --dry-run it prints the plain-text version instead
+// and records nothing.
+func handlerDigestSend(s *state, cmd command, user database.User) error {
+	fs := flag.NewFlagSet(cmd.Name, flag.ContinueOnError)
+	dryRun := fs.Bool("dry-run", false, "print the digest instead of sending it")
+	args, err := parseFlags(fs, cmd.Args)
+	if err != nil {
+		return err
+	}
+	if len(args) != 0 {
+		return fmt.Errorf("usage: %s [--dry-run]", cmd.Name)
+	}
+
+	subscription, err := s.db.GetDigestSubscription(context.Background(), user.ID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("%s isn't subscribed to digests, run digest subscribe first", user.Name)
+	}
+	if err != nil {
+		return fmt.Errorf("couldn't get digest subscription: %w", err)
+	}
+	recipient := digestRecipient{
+		UserID:        user.ID,
+		UserName:      user.Name,
+		Email:         subscription.Email,
+		Frequency:     subscription.Frequency,
+		LastWindowEnd: subscription.LastWindowEnd,
+	}
+
+	if *dryRun {
+		d, err := loadDigest(context.Background(), s.db, recipient, time.Now().UTC())
+		if err != nil {
+			return err
+		}
+		var buf bytes.Buffer
+		err = digestText.Execute(&buf, d)
+		if err != nil {
+			return fmt.Errorf("couldn't render digest: %w", err)
+		}
+		fmt.Print(buf.String())
+		return nil
+	}
+
+	record, err := sendDigest(context.Background(), s.db, s.cfg, recipient)
+	if err != nil {
+		return err
+	}
+	if record.PostCount == 0 {
+		fmt.Println("No new posts since the last digest, so nothing was sent.")
+		return nil
+	}
+	fmt.Printf("Sent a digest of %d posts to %s.\n", record.PostCount, record.Email)
+	return nil
+}
+
+// handlerDigestRun sends every digest that's due, for running from cron
+// when agg isn't sending them with --digest-every.
+func handlerDigestRun(s *state, cmd command) error {
+	if len(cmd.Args) != 0 {
+		return fmt.Errorf("usage: %s", cmd.Name)
+	}
+	if s.cfg.SMTPHost == "" {
+		return errSMTPNotConfigured
+	}
+
+	sent, err := sendDueDigests(context.Background(), s.db, s.cfg)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Sent %d digests.\n", sent)
+	return nil
+}
+
+func handlerDigestHistory(s *state, cmd command, user database.User) error {
+	fs := flag.NewFlagSet(cmd.Name, flag.ContinueOnError)
+	limit := fs.Int("limit", 10, "number of digests to show")
+	args, err := parseFlags(fs, cmd.Args)
+	if err != nil {
+		return err
+	}
+	if len(args) != 0 {
+		return fmt.Errorf("usage: %s [--limit n]", cmd.Name)
+	}
+
+	subscription, err := s.db.GetDigestSubscription(context.Background(), user.ID)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		fmt.Printf("%s isn't subscribed to digests.\n", user.Name)
+	case err != nil:
+		return fmt.Errorf("couldn't get digest subscription: %w", err)
+	default:
+		fmt.Printf("%s gets a %s digest at %s.\n", user.Name, subscription.Frequency, subscription.Email)
+	}
+
+	digests, err := s.db.GetDigestsForUser(context.Background(), database.GetDigestsForUserParams{
+		UserID: user.ID,
+		Limit:  int32(*limit),
+	})
+	if err != nil {
+		return fmt.Errorf("couldn't get digests: %w", err)
+	}
+
+	if len(digests) == 0 {
+		fmt.Println("No digests sent yet.")
+		return nil
+	}
+
+	for _, d := range digests {
+		if d.PostCount == 0 {
+			fmt.Printf("* %v  nothing new since %v, not sent\n", d.SentAt.Format(time.DateTime), d.WindowStart.Format(time.DateTime))
+			continue
+		}
+		fmt.Printf("* %v  %d posts since %v to %s\n", d.SentAt.Format(time.DateTime), d.PostCount, d.WindowStart.Format(time.DateTime), d.Email)
+	}
+	return nil
+}
+
+// sendDueDigests sends the digest of every subscriber whose last one is at
+// least a period old and returns how many were sent. A failed digest is
+// logged and retried next time.
+func sendDueDigests(ctx context.Context, db *database.Queries, cfg *config.Config) (int, error) {
+	subscriptions, err := db.GetDueDigestSubscriptions(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("couldn't get due digests: %w", err)
+	}
+
+	sent := 0
+	for _, subscription := range subscriptions {
+		if ctx.Err() != nil {
+			break
+		}
+		record, err := sendDigest(ctx, db, cfg, digestRecipient{
+			UserID:        subscription.UserID,
+			UserName:      subscription.UserName,
+			Email:         subscription.Email,
+			Frequency:     subscription.Frequency,
+			LastWindowEnd: subscription.LastWindowEnd,
+		})
+		if err != nil {
+			log.Printf("Couldn't send digest to %s: %v", subscription.UserName, err)
+			continue
+		}
+		if record.PostCount > 0 {
+			log.Printf("Sent a digest of %d posts to %s", record.PostCount, subscription.UserName)
+			sent++
+		}
+	}
+	return sent, nil
+}
+
+// sendDigest emails recipient the posts that arrived since their last digest
+// and records it, which starts the next digest's window. When nothing new
+// arrived no email is sent, but the empty digest is still recorded so the
+// next one goes out a full period later.
+func sendDigest(ctx context.Context, db *database.Queries, cfg *config.Config, recipient digestRecipient) (database.Digest, error) {
+	d, err := loadDigest(ctx, db, recipient, time.Now().UTC())
+	if err != nil {
+		return database.Digest{}, err
+	}
+
+	if d.PostCount > 0 {
+		msg, err := composeDigest(cfg.SMTPFrom, recipient.Email, d)
+		if err != nil {
+			return database.Digest{}, err
+		}
+		err = sendMail(cfg, recipient.Email, msg)
+		if err != nil {
+			return database.Digest{}, fmt.Errorf("couldn't send email: %w", err)
+		}
+	}
+
+	record, err := db.CreateDigest(ctx, database.CreateDigestParams{
+		ID:          uuid.New(),
+		SentAt:      time.Now().UTC(),
+		UserID:      recipient.UserID,
+		Email:       recipient.Email,
+		WindowStart: d.WindowStart,
+		WindowEnd:   d.WindowEnd,
+		PostCount:   int32(d.PostCount),
+	})
+	if err != nil {
+		return database.Digest{}, fmt.Errorf("couldn't record digest: %w", err)
+	}
+	return record, nil
+}
+
+// loadDigest gathers the unread posts that arrived after recipient's last
+// digest, or in the last period for their first one, up to now. When more
+// than maxDigestPosts arrived, the window ends at the last post that fits,
+// so the rest start the next digest's window rather than being skipped.
+func loadDigest(ctx context.Context, db *database.Queries, recipient digestRecipient, now time.Time) (digest, error) {
+	windowStart := now.Add(-digestPeriods[recipient.Frequency])
+	if recipient.LastWindowEnd.Valid {
+		windowStart = recipient.LastWindowEnd.Time
+	}
+
+	// Posts come oldest first, with one extra to tell whether any are left
+	// over.
+	posts, err := db.GetDigestPosts(ctx, database.GetDigestPostsParams{
+		UserID:      recipient.UserID,
+		WindowStart: windowStart,
+		WindowEnd:   now,
+		MaxPosts:    maxDigestPosts + 1,
+	})
+	if err != nil {
+		return digest{}, fmt.Errorf("couldn't get posts for digest: %w", err)
+	}
+
+	windowEnd := now
+	truncated := len(posts) > maxDigestPosts
+	if truncated {
+		next := posts[maxDigestPosts]
+		posts = posts[:maxDigestPosts]
+		// The next window starts after windowEnd, so leave out posts that
+		// arrived at the same moment as the first one left over.
+		n := len(posts)
+		for n > 0 && posts[n-1].CreatedAt.Equal(next.CreatedAt) {
+			n--
+		}
+		if n > 0 {
+			posts = posts[:n]
+		}
+		windowEnd = posts[len(posts)-1].CreatedAt
+	}
+
+	slices.SortStableFunc(posts, func(a, b database.GetDigestPostsRow) int {
+		return cmp.Or(
+			cmp.Compare(a.FeedName, b.FeedName),
+			cmp.Compare(a.FeedUrl, b.FeedUrl),
+			b.PublishedAt.Time.Compare(a.PublishedAt.Time),
+		)
+	})
+
+	d := digest{
+		Subject:     fmt.Sprintf("Your %s gator digest for %s", recipient.Frequency, now.Format("Jan 2, 2006")),
+		Frequency:   recipient.Frequency,
+		SentAt:      now,
+		WindowStart: windowStart,
+		WindowEnd:   windowEnd,
+		PostCount:   len(posts),
+		Truncated:   truncated,
+	}
+	for _, post := range posts {
+		if len(d.Feeds) == 0 || d.Feeds[len(d.Feeds)-1].URL != post.FeedUrl {
+			d.Feeds = append(d.Feeds, digestFeed{
+				Name: post.FeedName,
+				URL:  post.FeedUrl,
+			})
+		}
+		feed := &d.Feeds[len(d.Feeds)-1]
+		feed.Posts = append(feed.Posts, post)
+	}
+	return d, nil
+}
+
+// composeDigest renders d as a multipart/alternative email with plain-text
+// and HTML versions.
+func composeDigest(from, to string, d digest) ([]byte, error) {
+	var text, html bytes.Buffer
+	err := digestText.Execute(&text, d)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't render digest: %w", err)
+	}
+	err = digestHTML.Execute(&html, d)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't render digest: %w", err)
+	}
+
+	var body bytes.Buffer
+	parts := multipart.NewWriter(&body)
+	for _, part := range []struct {
+		contentType string
+		content     []byte
+	}{
+		{"text/plain; charset=utf-8", text.Bytes()},
+		{"text/html; charset=utf-8", html.Bytes()},
+	} {
+		w, err := parts.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return nil, err
+		}
+		qp := quotedprintable.NewWriter(w)
+		_, err = qp.Write(part.content)
+		if err != nil {
+			return nil, err
+		}
+		err = qp.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+	err = parts.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	var msg bytes.Buffer
+	headers := []struct{ name, value string }{
+		{"From", from},
+		{"To", to},
+		{"Subject", mime.QEncoding.Encode("utf-8", d.Subject)},
+		{"Date", d.SentAt.Format(time.RFC1123Z)},
+		{"Message-ID", fmt.Sprintf("<%s@gator>", uuid.New())},
+		{"MIME-Version", "1.0"},
+		{"Content-Type", "multipart/alternative; boundary=" + strconv.Quote(parts.Boundary())},
+	}
+	for _, header := range headers {
+		fmt.Fprintf(&msg, "%s: %s\r\n", header.name, header.value)
+	}
+	msg.WriteString("\r\n")
+	msg.Write(body.Bytes())
+	return msg.Bytes(), nil
+}
+
+var errSMTPNotConfigured = errors.New("no SMTP server configured: set smtp_host and smtp_from in the config file")
+
+// sendMail delivers msg to one recipient through the configured SMTP server,
+// upgrading to TLS when the server supports it and authenticating when a
+// username is set.
+func sendMail(cfg *config.Config, to string, msg []byte) error {
+	if cfg.SMTPHost == "" || cfg.SMTPFrom == "" {
+		return errSMTPNotConfigured
+	}
+	from, err := mail.ParseAddress(cfg.SMTPFrom)
+	if err != nil {
+		return fmt.Errorf("invalid smtp_from %q: %w", cfg.SMTPFrom, err)
+	}
+
+	port := cfg.SMTPPort
+	if port == 0 {
+		port = 587
+	}
+
+	var auth smtp.Auth
+	if cfg.SMTPUsername != "" {
+		auth = smtp.PlainAuth("", cfg.SMTPUsername, cfg.SMTPPassword, cfg.SMTPHost)
+	}
+
+	addr := net.JoinHostPort(cfg.SMTPHost, strconv.Itoa(port))
+	return smtp.SendMail(addr, auth, from.Address, []string{to}, msg)
+}
@@ -0,0 +1,240 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"maps"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/mail"
+	"net/textproto"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/VuTLy/blogAggregator/internal/config"
+	"github.com/VuTLy/blogAggregator/internal/database"
+)
+
+// startSMTPStub listens for SMTP on a local port and sends every message it
+// accepts on the returned channel. It speaks just enough of the protocol
+// for net/smtp, without STARTTLS or AUTH.
+func startSMTPStub(t *testing.T) (*net.TCPAddr, <-chan []byte) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	messages := make(chan []byte, 10)
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go serveSMTPStub(conn, messages)
+		}
+	}()
+	return ln.Addr().(*net.TCPAddr), messages
+}
+
+func serveSMTPStub(conn net.Conn, messages chan<- []byte) {
+	defer conn.Close()
+	text := textproto.NewConn(conn)
+	text.PrintfLine("220 localhost ESMTP stub")
+	for {
+		line, err := text.ReadLine()
+		if err != nil {
+			return
+		}
+		verb, _, _ := strings.Cut(strings.ToUpper(line), " ")
+		switch verb {
+		case "EHLO", "HELO":
+			text.PrintfLine("250-localhost")
+			text.PrintfLine("250 8BITMIME")
+		case "MAIL", "RCPT", "RSET", "NOOP":
+			text.PrintfLine("250 OK")
+		case "DATA":
+			text.PrintfLine("354 go ahead")
+			msg, err := text.ReadDotBytes()
+			if err != nil {
+				return
+			}
+			messages <- msg
+			text.PrintfLine("250 OK")
+		case "QUIT":
+			text.PrintfLine("221 bye")
+			return
+		default:
+			text.PrintfLine("502 not implemented")
+		}
+	}
+}
+
+func TestSendDigest(t *testing.T) {
+	db, queries := testDB(t)
+	ctx := context.Background()
+	user := createTestUser(t, queries, "alice")
+
+	alpha := createTestFeed(t, queries, user, "https://alpha.example.com/feed.xml")
+	beta := createTestFeed(t, queries, user, "https://beta.example.com/feed.xml")
+	for _, feed := range []database.Feed{beta, alpha} {
+		createTestFeedFollow(t, queries, user, feed)
+	}
+	_, err := db.Exec(`UPDATE feeds SET name = CASE WHEN id = $1 THEN 'Alpha' ELSE 'Beta' END`, alpha.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Arrivals alternate between the feeds.
+	createTestPost(t, queries, beta, "Beta one")
+	createTestPost(t, queries, alpha, "Alpha one")
+	createTestPost(t, queries, beta, "Beta two")
+	createTestPost(t, queries, alpha, "Alpha two")
+
+	addr, messages := startSMTPStub(t)
+	cfg := &config.Config{
+		SMTPHost: addr.IP.String(),
+		SMTPPort: addr.Port,
+		SMTPFrom: "gator@example.com",
+	}
+	record, err := sendDigest(ctx, queries, cfg, digestRecipient{
+		UserID:    user.ID,
+		UserName:  user.Name,
+		Email:     "alice@example.com",
+		Frequency: "daily",
+	})
+	if err != nil {
+		t.Fatalf("sendDigest: %v", err)
+	}
+
+	var raw []byte
+	select {
+	case raw = <-messages:
+	case <-time.After(5 * time.Second):
+		t.Fatal("no message reached the SMTP server")
+	}
+	msg, err := mail.ReadMessage(bytes.NewReader(raw))
+	if err != nil {
+		t.Fatalf("invalid message: %v", err)
+	}
+	if msg.Header.Get("To") != "alice@example.com" {
+		t.Errorf("To = %q", msg.Header.Get("To"))
+	}
+	mediaType, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/alternative" {
+		t.Fatalf("Content-Type = %q", msg.Header.Get("Content-Type"))
+	}
+
+	parts := map[string]string{}
+	reader := multipart.NewReader(msg.Body, params["boundary"])
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		mediaType, _, _ := mime.ParseMediaType(part.Header.Get("Content-Type"))
+		dat, err := io.ReadAll(part)
+		if err != nil {
+			t.Fatal(err)
+		}
+		parts[mediaType] = string(dat)
+	}
+	if len(parts) != 2 || parts["text/plain"] == "" || parts["text/html"] == "" {
+		t.Fatalf("got parts %v, want text/plain and text/html", slices.Sorted(maps.Keys(parts)))
+	}
+
+	// Each feed's posts are listed together under its name, newest first.
+	text := parts["text/plain"]
+	order := []string{"== Alpha ==", "Alpha two", "Alpha one", "== Beta ==", "Beta two", "Beta one"}
+	last := -1
+	for _, s := range order {
+		i := strings.Index(text, s)
+		if i <= last {
+			t.Fatalf("%q out of order in digest:\n%s", s, text)
+		}
+		last = i
+	}
+	if !strings.Contains(parts["text/html"], "Alpha two") {
+		t.Errorf("HTML part is missing posts:\n%s", parts["text/html"])
+	}
+
+	history, err := queries.GetDigestsForUser(ctx, database.GetDigestsForUserParams{
+		UserID: user.ID,
+		Limit:  10,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(history) != 1 || history[0].ID != record.ID || history[0].PostCount != 4 || history[0].Email != "alice@example.com" {
+		t.Errorf("digest history = %+v", history)
+	}
+}
+
+func TestLoadDigestCarriesOverTruncatedPosts(t *testing.T) {
+	db, queries := testDB(t)
+	user := createTestUser(t, queries, "alice")
+	early := createTestFeed(t, queries, user, "https://a.example.com/feed.xml")
+	late := createTestFeed(t, queries, user, "https://z.example.com/feed.xml")
+	for _, feed := range []database.Feed{early, late} {
+		createTestFeedFollow(t, queries, user, feed)
+	}
+
+	// More posts than fit in one digest, alternating between the feeds, so
+	// the feed last in the alphabet has posts on both sides of the cut.
+	const total = maxDigestPosts + 5
+	_, err := db.Exec(`INSERT INTO posts (id, created_at, updated_at, title, url, published_at, feed_id, guid)
+		SELECT gen_random_uuid(), t, t, 'Post ' || i, 'https://example.com/' || i, t,
+			CASE WHEN i % 2 = 0 THEN $1::uuid ELSE $2::uuid END, 'post-' || i
+		FROM generate_series(1, $3::int) AS i,
+		LATERAL (SELECT (NOW() AT TIME ZONE 'UTC') - INTERVAL '1 hour' + i * INTERVAL '1 second' AS t) times`,
+		early.ID, late.ID, total)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now().UTC()
+	recipient := digestRecipient{UserID: user.ID, UserName: user.Name, Email: "alice@example.com", Frequency: "daily"}
+	first, err := loadDigest(context.Background(), queries, recipient, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.PostCount != maxDigestPosts || !first.Truncated {
+		t.Fatalf("first digest has %d posts (truncated %t), want %d truncated", first.PostCount, first.Truncated, maxDigestPosts)
+	}
+	if !first.WindowEnd.Before(now) {
+		t.Errorf("truncated digest's window ends at %s, want before %s", first.WindowEnd, now)
+	}
+
+	// The next digest picks up where the first stopped.
+	recipient.LastWindowEnd.Time, recipient.LastWindowEnd.Valid = first.WindowEnd, true
+	second, err := loadDigest(context.Background(), queries, recipient, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if second.PostCount != total-maxDigestPosts || second.Truncated {
+		t.Errorf("second digest has %d posts (truncated %t), want %d", second.PostCount, second.Truncated, total-maxDigestPosts)
+	}
+
+	seen := map[string]bool{}
+	for _, d := range []digest{first, second} {
+		for _, feed := range d.Feeds {
+			for _, post := range feed.Posts {
+				if seen[post.Title] {
+					t.Errorf("%s is in both digests", post.Title)
+				}
+				seen[post.Title] = true
+			}
+		}
+	}
+	if len(seen) != total {
+		t.Errorf("digests listed %d posts, want %d", len(seen), total)
+	}
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"html"
+	"mime"
+	"net/http"
+	"os"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// feedLinkTypes are the <link type> values that advertise a feed.
+var feedLinkTypes = map[string]bool{
+	"application/rss+xml":   true,
+	"application/atom+xml":  true,
+	"application/feed+json": true,
+	"application/json":      true,
+	"application/rdf+xml":   true,
+}
+
+// commonFeedPaths are tried on the site's root when a page doesn't advertise
+// its feeds.
+var commonFeedPaths = []string{
+	"/feed",
+	"/rss",
+	"/rss.xml",
+	"/atom.xml",
+	"/feed.xml",
+	"/index.xml",
+	"/feed.json",
+}
+
+var (
+	linkTagPattern = regexp.MustCompile(`(?is)<link\b[^>]*>`)
+	attrPattern    = regexp.MustCompile(`(?is)([a-z][a-z0-9:-]*)\s*=\s*(?:"([^"]*)"|'([^']*)'|([^\s"'>]+))`)
+)
+
+type feedCandidate struct {
+	URL   string
+	Title string
+}
+
+// discoverFeeds finds the feeds for pageURL, fetching pages with client.
+// A feed URL is returned as the only candidate. For an HTML page, the feeds
+// it advertises with <link rel="alternate"> and the common feed paths on its
+// site are tried, and only the ones that parse as feeds are returned.
+func discoverFeeds(ctx context.Context, client *http.Client, pageURL string) ([]feedCandidate, error) {
+	doc, err := fetchDocument(ctx, client, pageURL, feedValidators{})
+	if err != nil {
+		return nil, err
+	}
+
+	if rssFeed, err := parseFeed(doc.Body); err == nil {
+		return []feedCandidate{{URL: pageURL, Title: rssFeed.Channel.Title}}, nil
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(doc.ContentType)
+	if mediaType != "text/html" && mediaType != "application/xhtml+xml" {
+		return nil, fmt.Errorf("%s is neither a feed nor an HTML page", pageURL)
+	}
+
+	var urls []string
+	seen := map[string]bool{}
+	addURL := func(ref string) {
+		u, err := doc.URL.Parse(strings.TrimSpace(ref))
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+			return
+		}
+		u.Fragment = ""
+		if !seen[u.String()] {
+			seen[u.String()] = true
+			urls = append(urls, u.String())
+		}
+	}
+	for _, link := range feedLinks(string(doc.Body)) {
+		addURL(link)
+	}
+	for _, path := range commonFeedPaths {
+		addURL(path)
+	}
+
+	var candidates []feedCandidate
+	for _, candidateURL := range urls {
+		rssFeed, _, err := fetchFeed(ctx, client, candidateURL, feedValidators{})
+		if err != nil {
+			continue
+		}
+		candidates = append(candidates, feedCandidate{
+			URL:   candidateURL,
+			Title: rssFeed.Channel.Title,
+		})
+	}
+	if len(candidates) == 0 {
+		return nil, fmt.Errorf("no feeds found on %s", pageURL)
+	}
+	return candidates, nil
+}
+
+// feedLinks returns the hrefs of the <link rel="alternate"> feed tags in an
+// HTML page, in document order.
+func feedLinks(page string) []string {
+	var hrefs []string
+	for _, tag := range linkTagPattern.FindAllString(page, -1) {
+		attrs := map[string]string{}
+		for _, match := range attrPattern.FindAllStringSubmatch(tag, -1) {
+			attrs[strings.ToLower(match[1])] = html.UnescapeString(match[2] + match[3] + match[4])
+		}
+
+		rels := strings.Fields(strings.ToLower(attrs["rel"]))
+		isAlternate := slices.Contains(rels, "alternate") && !slices.Contains(rels, "stylesheet")
+		if isAlternate && feedLinkTypes[strings.ToLower(strings.TrimSpace(attrs["type"]))] && attrs["href"] != "" {
+			hrefs = append(hrefs, attrs["href"])
+		}
+	}
+	return hrefs
+}
+
+// resolveFeedURL turns a feed or website URL into a feed URL, asking the user
+// to choose when a site has several feeds and stdin is a terminal, and
+// picking the first one otherwise.
+func resolveFeedURL(ctx context.Context, pageURL string) (string, error) {
+	candidates, err := discoverFeeds(ctx, feedHTTPClient, pageURL)
+	if err != nil {
+		return "", err
+	}
+	if len(candidates) == 1 || !stdinIsTerminal() {
+		return candidates[0].URL, nil
+	}
+
+	fmt.Printf("Found %d feeds on %s:\n", len(candidates), pageURL)
+	for i, candidate := range candidates {
+		fmt.Printf("  %d) %s (%s)\n", i+1, candidate.Title, candidate.URL)
+	}
+	fmt.Printf("Choose a feed [1]: ")
+
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && line == "" {
+		return candidates[0].URL, nil
+	}
+	line = strings.TrimSpace(line)
+	if line == "" {
+		return candidates[0].URL, nil
+	}
+	choice, err := strconv.Atoi(line)
+	if err != nil || choice < 1 || choice > len(candidates) {
+		return "", errors.New("invalid choice")
+	}
+	return candidates[choice-1].URL, nil
+}
+
+func stdinIsTerminal() bool {
+	info, err := os.Stdin.Stat()
+	if err != nil {
+		return false
+	}
+	return info.Mode()&os.ModeCharDevice != 0
+}
@@ -3,10 +3,17 @@ package main
 import (
 	"context"
 	"database/sql"
+	"errors"
+	"flag"
 	"fmt"
 	"log"
+	"math"
+	"os"
+	"os/signal"
 	"strconv"
 	"strings"
+	"sync"
+	"syscall"
 	"time"
 
 	"github.com/VuTLy/blogAggregator/internal/database"
@@ -14,56 +21,254 @@ import (
 )
 
 func handlerAgg(s *state, cmd command) error {
-	if len(cmd.Args) < 1 || len(cmd.Args) > 2 {
-		return fmt.Errorf("usage: %v <time_between_reqs>", cmd.Name)
+	fs := flag.NewFlagSet(cmd.Name, flag.ContinueOnError)
+	concurrency := fs.Int("concurrency", 4, "number of feeds to scrape in parallel")
+	batchSize := fs.Int("batch", 20, "number of feeds to claim per tick")
+	maxFailures := fs.Int("max-failures", 10, "disable a feed after this many consecutive failures (0 never disables)")
+	pruneEvery := fs.Duration("prune-every", 0, "run the post retention job this often (0 disables it)")
+	maxAge := fs.String("max-age", "0", "retention job's max post age for feeds without their own (e.g. 30d); 0 keeps them")
+	drainTimeout := fs.Duration("drain-timeout", 30*time.Second, "how long in-flight feeds may keep running after a shutdown signal")
+	digestEvery := fs.Duration("digest-every", 0, "check for due email digests this often (0 disables sending)")
+	webhookEvery := fs.Duration("webhook-every", 10*time.Second, "send queued webhook deliveries this often (0 disables sending)")
+	args, err := parseFlags(fs, cmd.Args)
+	if err != nil {
+		return err
+	}
+	if len(args) != 1 {
+		return fmt.Errorf("usage: %v <time_between_reqs> [--concurrency n] [--batch n] [--max-failures n] [--prune-every d] [--max-age d] [--drain-timeout d] [--digest-every d] [--webhook-every d]", cmd.Name)
+	}
+	if *concurrency < 1 || *batchSize < 1 {
+		return errors.New("concurrency and batch size must be at least 1")
 	}
 
-	timeBetweenRequests, err := time.ParseDuration(cmd.Args[0])
+	timeBetweenRequests, err := time.ParseDuration(args[0])
 	if err != nil {
 		return fmt.Errorf("invalid duration: %w", err)
 	}
+	defaultMaxAge, err := parseMaxAge(*maxAge)
+	if err != nil {
+		return fmt.Errorf("invalid --max-age: %w", err)
+	}
+	if *digestEvery > 0 && s.cfg.SMTPHost == "" {
+		return errSMTPNotConfigured
+	}
+
+	// ctx is cancelled by the first SIGINT or SIGTERM, which stops new feeds
+	// from being claimed. Feeds already being scraped run on workCtx, which
+	// is only cancelled once the drain timeout has passed. A second signal
+	// kills the process straight away.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	workCtx, cancelWork := context.WithCancel(context.WithoutCancel(ctx))
+	defer cancelWork()
+	context.AfterFunc(ctx, func() {
+		stop()
+		log.Printf("Shutting down, giving in-flight feeds up to %s to finish...", *drainTimeout)
+		time.AfterFunc(*drainTimeout, cancelWork)
+	})
 
-	log.Printf("Collecting feeds every %s...", timeBetweenRequests)
+	log.Printf("Checking for due feeds every %s, collecting up to %d with %d workers...", timeBetweenRequests, *batchSize, *concurrency)
+
+	stats := &aggStats{started: time.Now()}
+
+	var dispatcher sync.WaitGroup
+	if *webhookEvery > 0 {
+		dispatcher.Add(1)
+		go func() {
+			defer dispatcher.Done()
+			runWebhookDispatcher(ctx, workCtx, s.db, stats, *webhookEvery)
+		}()
+	}
 
 	ticker := time.NewTicker(timeBetweenRequests)
+	defer ticker.Stop()
+
+	var lastPrune, lastDigest time.Time
+	for {
+		scrapeFeeds(ctx, workCtx, s, stats, *concurrency, *batchSize, *maxFailures)
 
-	for ; ; <-ticker.C {
-		scrapeFeeds(s)
+		if ctx.Err() == nil && *pruneEvery > 0 && time.Since(lastPrune) >= *pruneEvery {
+			runRetention(workCtx, s.db, defaultMaxAge)
+			lastPrune = time.Now()
+		}
+
+		if ctx.Err() == nil && *digestEvery > 0 && time.Since(lastDigest) >= *digestEvery {
+			_, err := sendDueDigests(workCtx, s.db, s.cfg)
+			if err != nil {
+				log.Printf("Couldn't send digests: %v", err)
+			}
+			lastDigest = time.Now()
+		}
+
+		select {
+		case <-ctx.Done():
+			dispatcher.Wait()
+			stats.print()
+			return nil
+		case <-ticker.C:
+		}
 	}
 }
 
-func scrapeFeeds(s *state) {
-	feed, err := s.db.GetNextFeedToFetch(context.Background())
-	if err != nil {
-		log.Println("Couldn't get next feeds to fetch", err)
-		return
+// scrapeResult is the outcome of scraping one feed.
+type scrapeResult struct {
+	NewPosts     int
+	UpdatedPosts int
+	NotModified  bool
+	Interrupted  bool
+	Err          error
+}
+
+// aggStats tallies the scrapes of an agg run for the summary printed when it
+// shuts down.
+type aggStats struct {
+	mu           sync.Mutex
+	started      time.Time
+	scraped      int
+	notModified  int
+	failed       int
+	interrupted  int
+	newPosts     int
+	updatedPosts int
+
+	webhooksSent   int
+	webhooksFailed int
+}
+
+func (a *aggStats) record(result scrapeResult) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	switch {
+	case result.Interrupted:
+		a.interrupted++
+	case result.Err != nil:
+		a.failed++
+	case result.NotModified:
+		a.notModified++
+	default:
+		a.scraped++
+	}
+	a.newPosts += result.NewPosts
+	a.updatedPosts += result.UpdatedPosts
+}
+
+func (a *aggStats) recordWebhook(ok bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if ok {
+		a.webhooksSent++
+	} else {
+		a.webhooksFailed++
 	}
-	log.Println("Found a feed to fetch!")
-	scrapeFeed(s.db, feed)
 }
 
-func scrapeFeed(db *database.Queries, feed database.Feed) {
-	_, err := db.MarkFeedFetched(context.Background(), feed.ID)
+func (a *aggStats) print() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	log.Printf("Aggregator ran for %s:", time.Since(a.started).Round(time.Second))
+	log.Printf("* Feeds collected:    %d", a.scraped)
+	log.Printf("* Feeds unchanged:    %d", a.notModified)
+	log.Printf("* Feeds failed:       %d", a.failed)
+	log.Printf("* Feeds interrupted:  %d", a.interrupted)
+	log.Printf("* Posts new/updated:  %d/%d", a.newPosts, a.updatedPosts)
+	log.Printf("* Webhooks ok/failed: %d/%d", a.webhooksSent, a.webhooksFailed)
+}
+
+// scrapeFeeds claims up to batchSize feeds that are due and scrapes them, at
+// most concurrency at a time. Claiming marks the feeds fetched, pushes their
+// next fetch out by their interval, and skips rows another aggregator has
+// locked, so several agg processes can share one database without fetching
+// a feed twice.
+//
+// Once ctx is cancelled no more feeds are claimed or started, and the
+// claimed feeds that haven't started are released. Feeds already running
+// carry on until they finish or workCtx is cancelled.
+func scrapeFeeds(ctx, workCtx context.Context, s *state, stats *aggStats, concurrency, batchSize, maxFailures int) {
+	if ctx.Err() != nil {
+		return
+	}
+	feeds, err := s.db.ClaimFeedsToFetch(ctx, int32(batchSize))
 	if err != nil {
-		log.Printf("Couldn't mark feed %s fetched: %v", feed.Name, err)
+		if ctx.Err() == nil {
+			log.Println("Couldn't get next feeds to fetch", err)
+		}
 		return
 	}
+	log.Printf("Found %d feeds to fetch!", len(feeds))
 
-	feedData, err := fetchFeed(context.Background(), feed.Url)
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for i, feed := range feeds {
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			for _, unstarted := range feeds[i:] {
+				releaseFeedClaim(s.db, unstarted)
+			}
+			break
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+			stats.record(scrapeFeed(workCtx, s.conn, s.db, feed, maxFailures))
+		}()
+	}
+	wg.Wait()
+}
+
+func scrapeFeed(ctx context.Context, conn *sql.DB, db *database.Queries, feed database.Feed, maxFailures int) scrapeResult {
+	client := feedHTTPClient
+	if feed.PublicOnly {
+		client = publicHTTPClient
+	}
+	feedData, validators, err := fetchFeed(ctx, client, feed.Url, feedValidators{
+		ETag:         feed.Etag.String,
+		LastModified: feed.LastModified.String,
+	})
+	if errors.Is(err, errNotModified) {
+		log.Printf("Feed %s not modified since last fetch", feed.Name)
+		markFeedSucceeded(ctx, db, feed)
+		return scrapeResult{NotModified: true}
+	}
+	if err != nil && ctx.Err() != nil {
+		log.Printf("Fetching feed %s interrupted", feed.Name)
+		releaseFeedClaim(db, feed)
+		return scrapeResult{Interrupted: true, Err: err}
+	}
 	if err != nil {
 		log.Printf("Couldn't collect feed %s: %v", feed.Name, err)
-		return
+		markFeedFailed(ctx, db, feed, err, maxFailures)
+		return scrapeResult{Err: err}
 	}
+
+	fetchedAt := time.Now().UTC()
+	result := scrapeResult{}
+	rules := loadFeedRules(ctx, db, feed)
 	for _, item := range feedData.Channel.Item {
-		publishedAt := sql.NullTime{}
-		if t, err := time.Parse(time.RFC1123Z, item.PubDate); err == nil {
-			publishedAt = sql.NullTime{
-				Time:  t,
-				Valid: true,
-			}
+		if ctx.Err() != nil {
+			// Saving posts is idempotent, so the next fetch picks up
+			// where this one stopped.
+			log.Printf("Saving posts for feed %s interrupted (%d new, %d updated)", feed.Name, result.NewPosts, result.UpdatedPosts)
+			releaseFeedClaim(db, feed)
+			result.Interrupted = true
+			result.Err = ctx.Err()
+			return result
 		}
 
-		_, err = db.CreatePost(context.Background(), database.CreatePostParams{
+		publishedAt := sql.NullTime{
+			Time:  itemPublishedAt(item, fetchedAt),
+			Valid: true,
+		}
+
+		author := itemAuthor(item)
+		isNew, err := savePost(ctx, conn, db, rules, feed, item, database.UpsertPostParams{
 			ID:        uuid.New(),
 			CreatedAt: time.Now().UTC(),
 			UpdatedAt: time.Now().UTC(),
@@ -75,20 +280,354 @@ func scrapeFeed(db *database.Queries, feed database.Feed) {
 			},
 			Url:         item.Link,
 			PublishedAt: publishedAt,
+			Guid:        itemGUID(item),
+			Author: sql.NullString{
+				String: author,
+				Valid:  author != "",
+			},
 		})
+		if errors.Is(err, sql.ErrNoRows) {
+			// Already stored and unchanged upstream.
+			continue
+		}
 		if err != nil {
-			if strings.Contains(err.Error(), "duplicate key value violates unique constraint") {
-				continue
-			}
-			log.Printf("Couldn't create post: %v", err)
+			log.Printf("Couldn't save post %s: %v", item.Link, err)
 			continue
 		}
+		if isNew {
+			result.NewPosts++
+		} else {
+			result.UpdatedPosts++
+		}
+	}
+
+	interval := nextFetchInterval(feedData, time.Duration(feed.FetchIntervalSeconds)*time.Second)
+	err = db.UpdateFeedSchedule(ctx, database.UpdateFeedScheduleParams{
+		DelaySeconds:         int32(nextFetchTime(feedData, fetchedAt, interval).Sub(fetchedAt).Seconds()),
+		FetchIntervalSeconds: int32(interval.Seconds()),
+		ID:                   feed.ID,
+	})
+	if err != nil {
+		log.Printf("Couldn't schedule next fetch for feed %s: %v", feed.Name, err)
+	}
+
+	err = db.UpdateFeedValidators(ctx, database.UpdateFeedValidatorsParams{
+		ID: feed.ID,
+		Etag: sql.NullString{
+			String: validators.ETag,
+			Valid:  validators.ETag != "",
+		},
+		LastModified: sql.NullString{
+			String: validators.LastModified,
+			Valid:  validators.LastModified != "",
+		},
+	})
+	if err != nil {
+		log.Printf("Couldn't save cache validators for feed %s: %v", feed.Name, err)
+	}
+
+	markFeedSucceeded(ctx, db, feed)
+	log.Printf("Feed %s collected, %v posts found (%d new, %d updated)", feed.Name, len(feedData.Channel.Item), result.NewPosts, result.UpdatedPosts)
+	return result
+}
+
+// savePost stores a feed item. A new post has its rules applied and its
+// webhook deliveries queued in the same transaction, so a post is never
+// saved without them. It returns sql.ErrNoRows if the post was already
+// stored and hasn't changed.
+func savePost(ctx context.Context, conn *sql.DB, db *database.Queries, rules []postRule, feed database.Feed, item RSSItem, params database.UpsertPostParams) (bool, error) {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return false, fmt.Errorf("couldn't begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+	qtx := db.WithTx(tx)
+
+	if item.Link != "" && params.Guid != item.Link {
+		// Posts stored before GUIDs were tracked are keyed by their link.
+		// Move such a post over to its real GUID so the upsert finds it
+		// rather than storing it a second time.
+		_, err := qtx.RekeyLegacyPost(ctx, database.RekeyLegacyPostParams{
+			Guid:   params.Guid,
+			FeedID: feed.ID,
+			Url:    item.Link,
+		})
+		if err != nil {
+			return false, fmt.Errorf("couldn't re-key post: %w", err)
+		}
+	}
+
+	post, err := qtx.UpsertPost(ctx, params)
+	if err != nil {
+		return false, err
+	}
+	isNew := post.ID == params.ID
+	if isNew {
+		err = applyRules(ctx, qtx, rules, feed, post)
+		if err != nil {
+			return false, err
+		}
+		err = enqueueWebhooks(ctx, qtx, feed, post)
+		if err != nil {
+			return false, err
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return false, fmt.Errorf("couldn't commit post: %w", err)
+	}
+	return isNew, nil
+}
+
+func markFeedSucceeded(ctx context.Context, db *database.Queries, feed database.Feed) {
+	err := db.MarkFeedSucceeded(ctx, feed.ID)
+	if err != nil {
+		log.Printf("Couldn't mark feed %s succeeded: %v", feed.Name, err)
+	}
+}
+
+// markFeedFailed records a failed fetch and backs the feed off, disabling it
+// once it has failed maxFailures times in a row.
+func markFeedFailed(ctx context.Context, db *database.Queries, feed database.Feed, fetchErr error, maxFailures int) {
+	backoff := failureBackoff(feed, fetchErr)
+	updated, err := db.MarkFeedFailed(ctx, database.MarkFeedFailedParams{
+		LastError: sql.NullString{
+			String: fetchErr.Error(),
+			Valid:  true,
+		},
+		DelaySeconds: int32(backoff.Seconds()),
+		MaxFailures:  int32(maxFailures),
+		ID:           feed.ID,
+	})
+	if err != nil {
+		log.Printf("Couldn't mark feed %s failed: %v", feed.Name, err)
+		return
+	}
+
+	if updated.DisabledAt.Valid {
+		log.Printf("Feed %s disabled after %d consecutive failures", feed.Name, updated.ConsecutiveFailures)
+		return
+	}
+	log.Printf("Feed %s has failed %d times in a row, retrying in %s", feed.Name, updated.ConsecutiveFailures, backoff)
+}
+
+// releaseFeedClaim makes a claimed feed due again, for feeds that shutdown
+// kept from being scraped. It runs on its own short context because the
+// aggregator's contexts are usually cancelled by then.
+func releaseFeedClaim(db *database.Queries, feed database.Feed) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	err := db.ReleaseFeedClaim(ctx, feed.ID)
+	if err != nil {
+		log.Printf("Couldn't release feed %s: %v", feed.Name, err)
 	}
-	log.Printf("Feed %s collected, %v posts found", feed.Name, len(feedData.Channel.Item))
 }
 
 func handlerBrowse(s *state, cmd command, user database.User) error {
+	fs := flag.NewFlagSet(cmd.Name, flag.ContinueOnError)
+	includeRead := fs.Bool("all", false, "include posts already marked read")
+	showHidden := fs.Bool("show-hidden", false, "include posts hidden by rules")
+	markRead := fs.Bool("mark-read", false, "mark the listed posts read")
+	feedFilter := fs.String("feed", "", "only show posts from this feed `url or name`")
+	since := fs.String("since", "", "only show posts published after this date or duration ago (e.g. 24h, 7d)")
+	until := fs.String("until", "", "only show posts published before this date or duration ago")
+	offset := fs.Int("offset", 0, "skip this many posts, for paging")
+	order := fs.String("order", "desc", "sort by publication date, asc or desc")
+	args, err := parseFlags(fs, cmd.Args)
+	if err != nil {
+		return err
+	}
+	if len(args) > 1 {
+		return fmt.Errorf("usage: %s [limit] [--all] [--show-hidden] [--mark-read] [--feed url|name] [--since t] [--until t] [--offset n] [--order asc|desc]", cmd.Name)
+	}
+
 	limit := 2
+	if len(args) == 1 {
+		if specifiedLimit, err := strconv.Atoi(args[0]); err == nil {
+			limit = specifiedLimit
+		} else {
+			return fmt.Errorf("invalid limit: %w", err)
+		}
+	}
+	if limit <= 0 || limit > math.MaxInt32 {
+		return fmt.Errorf("invalid limit: must be between 1 and %d", math.MaxInt32)
+	}
+	if *offset < 0 || *offset > math.MaxInt32 {
+		return fmt.Errorf("invalid --offset: must be between 0 and %d", math.MaxInt32)
+	}
+	if *order != "asc" && *order != "desc" {
+		return fmt.Errorf("invalid order %q: must be asc or desc", *order)
+	}
+
+	params := database.GetFilteredPostsForUserParams{
+		UserID:        user.ID,
+		IncludeRead:   *includeRead,
+		IncludeHidden: *showHidden,
+		OldestFirst:   *order == "asc",
+		MaxPosts:      int32(limit),
+		SkipPosts:     int32(*offset),
+	}
+	if *feedFilter != "" {
+		feedID, err := findFollowedFeed(s, user, *feedFilter)
+		if err != nil {
+			return err
+		}
+		params.FeedID = uuid.NullUUID{
+			UUID:  feedID,
+			Valid: true,
+		}
+	}
+	if params.Since, err = parseTimeFilter(*since); err != nil {
+		return fmt.Errorf("invalid --since: %w", err)
+	}
+	if params.Until, err = parseTimeFilter(*until); err != nil {
+		return fmt.Errorf("invalid --until: %w", err)
+	}
+
+	rows, err := s.db.GetFilteredPostsForUser(context.Background(), params)
+	if err != nil {
+		return fmt.Errorf("couldn't get posts for user: %w", err)
+	}
+	posts := make([]database.GetPostsForUserRow, 0, len(rows))
+	for _, row := range rows {
+		posts = append(posts, database.GetPostsForUserRow(row))
+	}
+
+	fmt.Printf("Found %d posts for user %s:\n", len(posts), user.Name)
+	for _, post := range posts {
+		printPost(post)
+	}
+
+	if len(posts) == limit {
+		fmt.Printf("More posts may be available with --offset %d\n", *offset+limit)
+	}
+
+	if *markRead {
+		for _, post := range posts {
+			_, err := s.db.MarkPostRead(context.Background(), database.MarkPostReadParams{
+				UserID: user.ID,
+				PostID: post.ID,
+			})
+			if err != nil {
+				return fmt.Errorf("couldn't mark post read: %w", err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// findFollowedFeed resolves a --feed filter given as a feed URL or as the
+// name of a feed the user follows.
+func findFollowedFeed(s *state, user database.User, urlOrName string) (uuid.UUID, error) {
+	feed, err := s.db.GetFeedByURL(context.Background(), urlOrName)
+	if err == nil {
+		return feed.ID, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return uuid.Nil, fmt.Errorf("couldn't get feed: %w", err)
+	}
+
+	feedFollows, err := s.db.GetFeedFollowsForUser(context.Background(), user.ID)
+	if err != nil {
+		return uuid.Nil, fmt.Errorf("couldn't get feed follows: %w", err)
+	}
+	for _, ff := range feedFollows {
+		if strings.EqualFold(ff.FeedName, urlOrName) {
+			return ff.FeedID, nil
+		}
+	}
+	return uuid.Nil, fmt.Errorf("you don't follow a feed called %s", urlOrName)
+}
+
+// parseTimeFilter parses a --since or --until value, either a duration ago
+// ("24h", "7d") or an absolute date in any format parsePubDate accepts.
+func parseTimeFilter(value string) (sql.NullTime, error) {
+	if value == "" {
+		return sql.NullTime{}, nil
+	}
+
+	if d, err := parseLongDuration(value); err == nil {
+		return sql.NullTime{
+			Time:  time.Now().UTC().Add(-d),
+			Valid: true,
+		}, nil
+	}
+
+	if t, ok := parsePubDate(value); ok {
+		return sql.NullTime{
+			Time:  t,
+			Valid: true,
+		}, nil
+	}
+	return sql.NullTime{}, fmt.Errorf("%q is neither a duration nor a date", value)
+}
+
+func printPost(post database.GetPostsForUserRow) {
+	fmt.Printf("%s from %s\n", post.PublishedAt.Time.Format("Mon Jan 2"), post.FeedName)
+	fmt.Printf("--- %s ---\n", post.Title)
+	fmt.Printf("    %v\n", post.Description.String)
+	fmt.Printf("Link: %s\n", post.Url)
+	fmt.Printf("ID:   %s\n", post.ID)
+	fmt.Println("=====================================")
+}
+
+func handlerStar(s *state, cmd command, user database.User) error {
+	if len(cmd.Args) != 1 {
+		return fmt.Errorf("usage: %s <post-id>", cmd.Name)
+	}
+
+	postID, err := uuid.Parse(cmd.Args[0])
+	if err != nil {
+		return fmt.Errorf("invalid post id: %w", err)
+	}
+
+	err = s.db.StarPost(context.Background(), database.StarPostParams{
+		UserID:    user.ID,
+		PostID:    postID,
+		CreatedAt: time.Now().UTC(),
+	})
+	if err != nil {
+		return fmt.Errorf("couldn't star post: %w", err)
+	}
+
+	fmt.Println("Post starred!")
+	return nil
+}
+
+func handlerUnstar(s *state, cmd command, user database.User) error {
+	if len(cmd.Args) != 1 {
+		return fmt.Errorf("usage: %s <post-id>", cmd.Name)
+	}
+
+	postID, err := uuid.Parse(cmd.Args[0])
+	if err != nil {
+		return fmt.Errorf("invalid post id: %w", err)
+	}
+
+	count, err := s.db.UnstarPost(context.Background(), database.UnstarPostParams{
+		UserID: user.ID,
+		PostID: postID,
+	})
+	if err != nil {
+		return fmt.Errorf("couldn't unstar post: %w", err)
+	}
+	if count == 0 {
+		return errors.New("post isn't starred")
+	}
+
+	fmt.Println("Post unstarred!")
+	return nil
+}
+
+func handlerStarred(s *state, cmd command, user database.User) error {
+	if len(cmd.Args) > 1 {
+		return fmt.Errorf("usage: %s [limit]", cmd.Name)
+	}
+
+	limit := 20
 	if len(cmd.Args) == 1 {
 		if specifiedLimit, err := strconv.Atoi(cmd.Args[0]); err == nil {
 			limit = specifiedLimit
@@ -97,47 +636,155 @@ func handlerBrowse(s *state, cmd command, user database.User) error {
 		}
 	}
 
-	posts, err := s.db.GetPostsForUser(context.Background(), database.GetPostsForUserParams{
+	posts, err := s.db.GetStarredPostsForUser(context.Background(), database.GetStarredPostsForUserParams{
 		UserID: user.ID,
 		Limit:  int32(limit),
 	})
 	if err != nil {
-		return fmt.Errorf("couldn't get posts for user: %w", err)
+		return fmt.Errorf("couldn't get starred posts: %w", err)
 	}
 
-	fmt.Printf("Found %d posts for user %s:\n", len(posts), user.Name)
+	fmt.Printf("Found %d starred posts for user %s:\n", len(posts), user.Name)
 	for _, post := range posts {
-		fmt.Printf("%s from %s\n", post.PublishedAt.Time.Format("Mon Jan 2"), post.FeedName)
-		fmt.Printf("--- %s ---\n", post.Title)
-		fmt.Printf("    %v\n", post.Description.String)
-		fmt.Printf("Link: %s\n", post.Url)
-		fmt.Println("=====================================")
+		printPost(database.GetPostsForUserRow(post))
+	}
+
+	return nil
+}
+
+func handlerRead(s *state, cmd command, user database.User) error {
+	if len(cmd.Args) != 1 {
+		return fmt.Errorf("usage: %s <post-id|all|feed-url>", cmd.Name)
+	}
+
+	count, err := setReadState(s, user, cmd.Args[0], true)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Marked %d posts read.\n", count)
+	return nil
+}
+
+func handlerUnread(s *state, cmd command, user database.User) error {
+	if len(cmd.Args) != 1 {
+		return fmt.Errorf("usage: %s <post-id|all|feed-url>", cmd.Name)
+	}
+
+	count, err := setReadState(s, user, cmd.Args[0], false)
+	if err != nil {
+		return err
 	}
 
+	fmt.Printf("Marked %d posts unread.\n", count)
 	return nil
 }
 
+// setReadState marks a single post, every post the user follows ("all"), or
+// every post in a feed read or unread, and returns how many posts changed.
+func setReadState(s *state, user database.User, target string, read bool) (int64, error) {
+	if target == "all" {
+		var count int64
+		var err error
+		if read {
+			count, err = s.db.MarkAllPostsRead(context.Background(), database.MarkAllPostsReadParams{
+				UserID: user.ID,
+			})
+		} else {
+			count, err = s.db.MarkAllPostsUnread(context.Background(), user.ID)
+		}
+		if err != nil {
+			return 0, fmt.Errorf("couldn't update posts: %w", err)
+		}
+		return count, nil
+	}
+
+	if postID, err := uuid.Parse(target); err == nil {
+		var count int64
+		if read {
+			count, err = s.db.MarkPostRead(context.Background(), database.MarkPostReadParams{
+				UserID: user.ID,
+				PostID: postID,
+			})
+		} else {
+			count, err = s.db.MarkPostUnread(context.Background(), database.MarkPostUnreadParams{
+				UserID: user.ID,
+				PostID: postID,
+			})
+		}
+		if err != nil {
+			return 0, fmt.Errorf("couldn't update post: %w", err)
+		}
+		return count, nil
+	}
+
+	feed, err := s.db.GetFeedByURL(context.Background(), target)
+	if err != nil {
+		return 0, fmt.Errorf("couldn't get feed: %w", err)
+	}
+
+	var count int64
+	if read {
+		count, err = s.db.MarkFeedPostsRead(context.Background(), database.MarkFeedPostsReadParams{
+			UserID: user.ID,
+			FeedID: feed.ID,
+		})
+	} else {
+		count, err = s.db.MarkFeedPostsUnread(context.Background(), database.MarkFeedPostsUnreadParams{
+			UserID: user.ID,
+			FeedID: feed.ID,
+		})
+	}
+	if err != nil {
+		return 0, fmt.Errorf("couldn't update posts: %w", err)
+	}
+	return count, nil
+}
+
 func handlerAddFeed(s *state, cmd command, user database.User) error {
 	if len(cmd.Args) != 2 {
 		return fmt.Errorf("usage: %s <name> <url>", cmd.Name)
 	}
 
 	name := cmd.Args[0]
-	url := cmd.Args[1]
+	url, err := resolveFeedURL(context.Background(), cmd.Args[1])
+	if err != nil {
+		return fmt.Errorf("couldn't find a feed at %s: %w", cmd.Args[1], err)
+	}
 
-	feed, err := s.db.CreateFeed(context.Background(), database.CreateFeedParams{
-		ID:        uuid.New(),
-		CreatedAt: time.Now().UTC(),
-		UpdatedAt: time.Now().UTC(),
-		UserID:    user.ID,
-		Name:      name,
-		Url:       url,
+	feed, feedFollow, err := addFeed(context.Background(), s.db, user, name, url, false)
+	if err != nil {
+		return err
+	}
+
+	fmt.Println("Feed created successfully:")
+	printFeed(feed, user)
+	fmt.Println()
+	fmt.Println("Feed followed successfully:")
+	printFeedFollow(feedFollow.UserName, feedFollow.FeedName)
+	fmt.Println("=====================================")
+	return nil
+}
+
+// addFeed creates a feed owned by user and follows it for them. feedURL must
+// already point at the feed itself rather than its website. publicOnly feeds
+// are only ever fetched from public addresses, for URLs a remote caller
+// supplied.
+func addFeed(ctx context.Context, db *database.Queries, user database.User, name, feedURL string, publicOnly bool) (database.Feed, database.CreateFeedFollowRow, error) {
+	feed, err := db.CreateFeed(ctx, database.CreateFeedParams{
+		ID:         uuid.New(),
+		CreatedAt:  time.Now().UTC(),
+		UpdatedAt:  time.Now().UTC(),
+		UserID:     user.ID,
+		Name:       name,
+		Url:        feedURL,
+		PublicOnly: publicOnly,
 	})
 	if err != nil {
-		return fmt.Errorf("couldn't create feed: %w", err)
+		return database.Feed{}, database.CreateFeedFollowRow{}, fmt.Errorf("couldn't create feed: %w", err)
 	}
 
-	feedFollow, err := s.db.CreateFeedFollow(context.Background(), database.CreateFeedFollowParams{
+	feedFollow, err := db.CreateFeedFollow(ctx, database.CreateFeedFollowParams{
 		ID:        uuid.New(),
 		CreatedAt: time.Now().UTC(),
 		UpdatedAt: time.Now().UTC(),
@@ -145,16 +792,10 @@ func handlerAddFeed(s *state, cmd command, user database.User) error {
 		FeedID:    feed.ID,
 	})
 	if err != nil {
-		return fmt.Errorf("couldn't create feed follow: %w", err)
+		return database.Feed{}, database.CreateFeedFollowRow{}, fmt.Errorf("couldn't create feed follow: %w", err)
 	}
 
-	fmt.Println("Feed created successfully:")
-	printFeed(feed, user)
-	fmt.Println()
-	fmt.Println("Feed followed successfully:")
-	printFeedFollow(feedFollow.UserName, feedFollow.FeedName)
-	fmt.Println("=====================================")
-	return nil
+	return feed, feedFollow, nil
 }
 
 func handlerListFeeds(s *state, cmd command) error {
@@ -181,6 +822,20 @@ func handlerListFeeds(s *state, cmd command) error {
 	return nil
 }
 
+func handlerEnableFeed(s *state, cmd command) error {
+	if len(cmd.Args) != 1 {
+		return fmt.Errorf("usage: %s <feed_url>", cmd.Name)
+	}
+
+	feed, err := s.db.EnableFeed(context.Background(), cmd.Args[0])
+	if err != nil {
+		return fmt.Errorf("couldn't enable feed: %w", err)
+	}
+
+	fmt.Printf("%s enabled, it will be fetched on the next agg tick.\n", feed.Name)
+	return nil
+}
+
 func printFeed(feed database.Feed, user database.User) {
 	fmt.Printf("* ID:            %s\n", feed.ID)
 	fmt.Printf("* Created:       %v\n", feed.CreatedAt)
@@ -189,6 +844,19 @@ func printFeed(feed database.Feed, user database.User) {
 	fmt.Printf("* URL:           %s\n", feed.Url)
 	fmt.Printf("* User:          %s\n", user.Name)
 	fmt.Printf("* LastFetchedAt: %v\n", feed.LastFetchedAt.Time)
+	fmt.Printf("* NextFetchAt:   %v\n", feed.NextFetchAt.Time)
+	fmt.Printf("* Interval:      %v\n", time.Duration(feed.FetchIntervalSeconds)*time.Second)
+	if feed.DisabledAt.Valid {
+		fmt.Printf("* Status:        disabled since %v\n", feed.DisabledAt.Time)
+	} else {
+		fmt.Printf("* Status:        active\n")
+	}
+	fmt.Printf("* LastSuccessAt: %v\n", feed.LastSuccessAt.Time)
+	fmt.Printf("* Failures:      %d\n", feed.ConsecutiveFailures)
+	if feed.LastError.Valid {
+		fmt.Printf("* LastError:     %s\n", feed.LastError.String)
+	}
+	printRetention(feed)
 }
 func handlerFollow(s *state, cmd command, user database.User) error {
 	if len(cmd.Args) != 1 {
@@ -196,6 +864,14 @@ func handlerFollow(s *state, cmd command, user database.User) error {
 	}
 
 	feed, err := s.db.GetFeedByURL(context.Background(), cmd.Args[0])
+	if errors.Is(err, sql.ErrNoRows) {
+		// Not a known feed URL; it may be the feed's website.
+		feedURL, discoverErr := resolveFeedURL(context.Background(), cmd.Args[0])
+		if discoverErr != nil {
+			return fmt.Errorf("couldn't find a feed at %s: %w", cmd.Args[0], discoverErr)
+		}
+		feed, err = s.db.GetFeedByURL(context.Background(), feedURL)
+	}
 	if err != nil {
 		return fmt.Errorf("couldn't get feed: %w", err)
 	}
@@ -210,6 +886,10 @@ func handlerFollow(s *state, cmd command, user database.User) error {
 	if err != nil {
 		return fmt.Errorf("couldn't create feed follow: %w", err)
 	}
+	_, err = hideMatchingPosts(context.Background(), s.db, user, uuid.NullUUID{UUID: feed.ID, Valid: true})
+	if err != nil {
+		return err
+	}
 
 	fmt.Println("Feed follow created:")
 	printFeedFollow(ffRow.UserName, ffRow.FeedName)
@@ -227,9 +907,22 @@ func handlerListFeedFollows(s *state, cmd command, user database.User) error {
 		return nil
 	}
 
+	unreadCounts, err := s.db.GetUnreadCountsForUser(context.Background(), user.ID)
+	if err != nil {
+		return fmt.Errorf("couldn't get unread counts: %w", err)
+	}
+	unread := map[uuid.UUID]int64{}
+	for _, row := range unreadCounts {
+		unread[row.FeedID] = row.UnreadCount
+	}
+
 	fmt.Printf("Feed follows for user %s:\n", user.Name)
 	for _, ff := range feedFollows {
-		fmt.Printf("* %s\n", ff.FeedName)
+		if ff.Category.Valid {
+			fmt.Printf("* %s [%s] (%d unread)\n", ff.FeedName, ff.Category.String, unread[ff.FeedID])
+			continue
+		}
+		fmt.Printf("* %s (%d unread)\n", ff.FeedName, unread[ff.FeedID])
 	}
 
 	return nil
@@ -245,13 +938,16 @@ func handlerUnfollow(s *state, cmd command, user database.User) error {
 		return fmt.Errorf("couldn't get feed: %w", err)
 	}
 
-	err = s.db.DeleteFeedFollow(context.Background(), database.DeleteFeedFollowParams{
+	count, err := s.db.DeleteFeedFollow(context.Background(), database.DeleteFeedFollowParams{
 		UserID: user.ID,
 		FeedID: feed.ID,
 	})
 	if err != nil {
 		return fmt.Errorf("couldn't delete feed follow: %w", err)
 	}
+	if count == 0 {
+		return fmt.Errorf("%s isn't following %s", user.Name, feed.Name)
+	}
 
 	fmt.Printf("%s unfollowed successfully!\n", feed.Name)
 	return nil
@@ -0,0 +1,364 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/VuTLy/blogAggregator/internal/database"
+	"github.com/google/uuid"
+)
+
+func TestClaimFeedsToFetchSkipsLockedFeeds(t *testing.T) {
+	db, queries := testDB(t)
+	user := createTestUser(t, queries, "alice")
+	for i := range 10 {
+		createTestFeed(t, queries, user, fmt.Sprintf("https://example.com/%d.xml", i))
+	}
+	ctx := context.Background()
+
+	// The first claimer holds its row locks until it commits, as it would
+	// while a slow UPDATE is still running.
+	tx1, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx1.Rollback()
+	first, err := queries.WithTx(tx1).ClaimFeedsToFetch(ctx, 6)
+	if err != nil {
+		t.Fatalf("first claim: %v", err)
+	}
+
+	// The second must skip those rows rather than wait for them or take
+	// them too.
+	tx2, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx2.Rollback()
+	claimCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	second, err := queries.WithTx(tx2).ClaimFeedsToFetch(claimCtx, 6)
+	if err != nil {
+		t.Fatalf("second claim: %v", err)
+	}
+
+	if len(first) != 6 || len(second) != 4 {
+		t.Errorf("claimed %d and %d feeds, want 6 and 4", len(first), len(second))
+	}
+	claimed := make(map[uuid.UUID]bool)
+	for _, feed := range first {
+		claimed[feed.ID] = true
+	}
+	for _, feed := range second {
+		if claimed[feed.ID] {
+			t.Errorf("feed %s claimed by both claimers", feed.Url)
+		}
+	}
+
+	if err := tx1.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	if err := tx2.Commit(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Claiming pushed every feed's next fetch out, so none is due now.
+	rest, err := queries.ClaimFeedsToFetch(ctx, 10)
+	if err != nil {
+		t.Fatalf("third claim: %v", err)
+	}
+	if len(rest) != 0 {
+		t.Errorf("claimed %d feeds again, want 0", len(rest))
+	}
+}
+
+func TestClaimFeedsToFetchConcurrently(t *testing.T) {
+	_, queries := testDB(t)
+	user := createTestUser(t, queries, "alice")
+	const feeds = 50
+	for i := range feeds {
+		createTestFeed(t, queries, user, fmt.Sprintf("https://example.com/%d.xml", i))
+	}
+
+	// Claimers race in batches until nothing is due, as several agg
+	// processes sharing a database would.
+	var mu sync.Mutex
+	claims := make(map[uuid.UUID]int)
+	var wg sync.WaitGroup
+	for range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				batch, err := queries.ClaimFeedsToFetch(context.Background(), 3)
+				if err != nil {
+					t.Errorf("claim: %v", err)
+					return
+				}
+				if len(batch) == 0 {
+					return
+				}
+				mu.Lock()
+				for _, feed := range batch {
+					claims[feed.ID]++
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if len(claims) != feeds {
+		t.Errorf("claimed %d distinct feeds, want %d", len(claims), feeds)
+	}
+	for id, count := range claims {
+		if count != 1 {
+			t.Errorf("feed %s claimed %d times", id, count)
+		}
+	}
+}
+
+func TestScrapeFeedRekeysLegacyPosts(t *testing.T) {
+	db, queries := testDB(t)
+	user := createTestUser(t, queries, "alice")
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/rss+xml")
+		fmt.Fprint(w, `<?xml version="1.0"?>
+<rss version="2.0"><channel><title>Blog</title>
+<item><title>New</title><link>https://blog.example.com/new</link><guid isPermaLink="false">post-2</guid><description>Two</description></item>
+<item><title>Old</title><link>https://blog.example.com/old</link><guid isPermaLink="false">post-1</guid><description>One</description></item>
+</channel></rss>`)
+	}))
+	defer server.Close()
+	feed := createTestFeed(t, queries, user, server.URL)
+
+	// Before GUIDs were tracked, the migration keyed stored posts by URL.
+	legacyID := uuid.New()
+	_, err := db.Exec(`INSERT INTO posts (id, created_at, updated_at, title, url, description, published_at, feed_id, guid)
+		VALUES ($1, NOW(), NOW(), 'Old', 'https://blog.example.com/old', 'One', NOW(), $2, 'https://blog.example.com/old')`,
+		legacyID, feed.ID)
+	if err != nil {
+		t.Fatalf("couldn't insert legacy post: %v", err)
+	}
+
+	result := scrapeFeed(context.Background(), db, queries, feed, 10)
+	if result.Err != nil {
+		t.Fatalf("scrapeFeed: %v", result.Err)
+	}
+	if result.NewPosts != 1 || result.UpdatedPosts != 0 {
+		t.Errorf("got %d new and %d updated posts, want 1 and 0", result.NewPosts, result.UpdatedPosts)
+	}
+
+	var guid string
+	err = db.QueryRow(`SELECT guid FROM posts WHERE id = $1`, legacyID).Scan(&guid)
+	if err != nil {
+		t.Fatalf("couldn't get legacy post: %v", err)
+	}
+	if guid != "post-1" {
+		t.Errorf("legacy post guid = %q, want post-1", guid)
+	}
+
+	// A second fetch finds both posts by their GUIDs.
+	result = scrapeFeed(context.Background(), db, queries, feed, 10)
+	if result.NewPosts != 0 || result.UpdatedPosts != 0 {
+		t.Errorf("refetch got %d new and %d updated posts, want none", result.NewPosts, result.UpdatedPosts)
+	}
+	var count int
+	err = db.QueryRow(`SELECT COUNT(*) FROM posts WHERE feed_id = $1`, feed.ID).Scan(&count)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 2 {
+		t.Errorf("feed has %d posts, want 2", count)
+	}
+}
+
+func TestSetReadStateCountsChangedPosts(t *testing.T) {
+	_, queries := testDB(t)
+	s := &state{db: queries}
+	user := createTestUser(t, queries, "alice")
+	feed := createTestFeed(t, queries, user, "https://example.com/feed.xml")
+	post := createTestPost(t, queries, feed, "Hello")
+
+	steps := []struct {
+		read bool
+		want int64
+	}{
+		{false, 0}, // never read, so there's nothing to mark unread
+		{true, 1},
+		{true, 0},
+		{false, 1},
+		{false, 0},
+	}
+	for i, step := range steps {
+		count, err := setReadState(s, user, post.ID.String(), step.read)
+		if err != nil {
+			t.Fatalf("step %d: setReadState: %v", i, err)
+		}
+		if count != step.want {
+			t.Errorf("step %d: marking read=%t changed %d posts, want %d", i, step.read, count, step.want)
+		}
+	}
+}
+
+func TestMarkFeedFailedBacksOffAndDisables(t *testing.T) {
+	db, queries := testDB(t)
+	ctx := context.Background()
+	user := createTestUser(t, queries, "alice")
+	feed := createTestFeed(t, queries, user, "https://example.com/feed.xml")
+
+	const maxFailures = 3
+	fetchErr := &httpStatusError{StatusCode: http.StatusInternalServerError}
+	var previous time.Duration
+	for i := int32(1); i <= maxFailures; i++ {
+		backoff := failureBackoff(feed, fetchErr)
+		if backoff <= previous {
+			t.Errorf("failure %d backs off %s, no longer than the %s before it", i, backoff, previous)
+		}
+		previous = backoff
+		markFeedFailed(ctx, queries, feed, fetchErr, maxFailures)
+
+		var err error
+		feed, err = queries.GetFeedByID(ctx, feed.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if feed.ConsecutiveFailures != i {
+			t.Fatalf("after failure %d: consecutive_failures = %d", i, feed.ConsecutiveFailures)
+		}
+		if !feed.LastError.Valid || feed.LastError.String != fetchErr.Error() {
+			t.Errorf("after failure %d: last_error = %+v", i, feed.LastError)
+		}
+
+		var waitSeconds float64
+		err = db.QueryRow(`SELECT EXTRACT(EPOCH FROM next_fetch_at - NOW()::timestamp)::float8 FROM feeds WHERE id = $1`,
+			feed.ID).Scan(&waitSeconds)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := backoff.Seconds(); waitSeconds < want-5 || waitSeconds > want+5 {
+			t.Errorf("after failure %d: next fetch in %.0fs, want %.0fs", i, waitSeconds, want)
+		}
+
+		if disabled := feed.DisabledAt.Valid; disabled != (i == maxFailures) {
+			t.Errorf("after failure %d: disabled = %t", i, disabled)
+		}
+	}
+}
+
+// testScheduleFeed returns a feed with an item published every gap, newest
+// first, and the given ttl and skip hints.
+func testScheduleFeed(items int, gap time.Duration, ttl string, skipHours, skipDays []string) *RSSFeed {
+	feed := &RSSFeed{}
+	newest := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	for i := range items {
+		date := newest.Add(-time.Duration(i) * gap)
+		feed.Channel.Item = append(feed.Channel.Item, RSSItem{PubDate: date.Format(time.RFC1123Z)})
+	}
+	feed.Channel.TTL = ttl
+	feed.Channel.SkipHours = skipHours
+	feed.Channel.SkipDays = skipDays
+	return feed
+}
+
+func TestNextFetchInterval(t *testing.T) {
+	tests := []struct {
+		name     string
+		feed     *RSSFeed
+		previous time.Duration
+		want     time.Duration
+	}{
+		{"no dated items", testScheduleFeed(0, 0, "", nil, nil), time.Hour, time.Hour},
+		{"one dated item", testScheduleFeed(1, 0, "", nil, nil), time.Hour, time.Hour},
+		{"posts every 6h", testScheduleFeed(5, 6*time.Hour, "", nil, nil), time.Hour, 2 * time.Hour},
+		{"posts every minute", testScheduleFeed(5, time.Minute, "", nil, nil), 15 * time.Minute, minFetchInterval},
+		{"posts every month", testScheduleFeed(5, 30*24*time.Hour, "", nil, nil), 24 * time.Hour, maxFetchInterval},
+		{"ttl", testScheduleFeed(0, 0, "180", nil, nil), time.Hour, 3 * time.Hour},
+		{"ttl under interval", testScheduleFeed(0, 0, " 30 ", nil, nil), time.Hour, time.Hour},
+		{"malformed ttl", testScheduleFeed(0, 0, "soon", nil, nil), time.Hour, time.Hour},
+		{"ttl over maximum", testScheduleFeed(0, 0, "10000", nil, nil), time.Hour, maxFetchInterval},
+	}
+	for _, tt := range tests {
+		if got := nextFetchInterval(tt.feed, tt.previous); got != tt.want {
+			t.Errorf("%s: nextFetchInterval = %s, want %s", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestNextFetchTime(t *testing.T) {
+	// A Monday.
+	from := time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name      string
+		interval  time.Duration
+		skipHours []string
+		skipDays  []string
+		want      time.Time
+	}{
+		{"no hints", time.Hour, nil, nil, from.Add(time.Hour)},
+		{"skipped hours", time.Hour, []string{"11", " 12 "}, nil, from.Add(3 * time.Hour)},
+		{"into a skipped hour", 90 * time.Minute, []string{"11"}, nil, from.Add(2 * time.Hour)},
+		{"hour 24", 14 * time.Hour, []string{"24"}, nil, from.Add(15 * time.Hour)},
+		{"malformed hour", time.Hour, []string{"eleven"}, nil, from.Add(time.Hour)},
+		{"skipped day", time.Hour, nil, []string{"Monday"}, from.Add(14 * time.Hour)},
+		{"skipped day and hour", time.Hour, []string{"0"}, []string{"monday"}, from.Add(15 * time.Hour)},
+		{"every hour skipped", time.Hour, []string{
+			"0", "1", "2", "3", "4", "5", "6", "7", "8", "9", "10", "11",
+			"12", "13", "14", "15", "16", "17", "18", "19", "20", "21", "22", "23",
+		}, nil, from.Add(time.Hour + 7*24*time.Hour)},
+	}
+	for _, tt := range tests {
+		feed := testScheduleFeed(0, 0, "", tt.skipHours, tt.skipDays)
+		if got := nextFetchTime(feed, from, tt.interval); !got.Equal(tt.want) {
+			t.Errorf("%s: nextFetchTime = %s, want %s", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestFailureBackoff(t *testing.T) {
+	tests := []struct {
+		name     string
+		interval int32
+		failures int32
+		err      error
+		want     time.Duration
+	}{
+		{"first failure", 3600, 0, errors.New("timeout"), 2 * time.Hour},
+		{"third failure", 3600, 2, errors.New("timeout"), 8 * time.Hour},
+		{"short interval", 60, 0, errors.New("timeout"), 2 * minFetchInterval},
+		{"many failures", 3600, 40, errors.New("timeout"), maxFailureBackoff},
+		{"longer Retry-After", 3600, 0, &httpStatusError{StatusCode: http.StatusServiceUnavailable, RetryAfter: 5 * time.Hour}, 5 * time.Hour},
+		{"shorter Retry-After", 3600, 0, &httpStatusError{StatusCode: http.StatusTooManyRequests, RetryAfter: 10 * time.Minute}, 2 * time.Hour},
+		{"wrapped Retry-After", 3600, 0, fmt.Errorf("couldn't fetch feed: %w", &httpStatusError{StatusCode: http.StatusTooManyRequests, RetryAfter: 5 * time.Hour}), 5 * time.Hour},
+		{"Retry-After on a 500", 3600, 0, &httpStatusError{StatusCode: http.StatusInternalServerError, RetryAfter: 5 * time.Hour}, 2 * time.Hour},
+		{"huge Retry-After", 3600, 0, &httpStatusError{StatusCode: http.StatusServiceUnavailable, RetryAfter: 100000 * time.Hour}, maxFailureBackoff},
+	}
+	for _, tt := range tests {
+		feed := database.Feed{FetchIntervalSeconds: tt.interval, ConsecutiveFailures: tt.failures}
+		if got := failureBackoff(feed, tt.err); got != tt.want {
+			t.Errorf("%s: failureBackoff = %s, want %s", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestHandlerBrowseRejectsInvalidPaging(t *testing.T) {
+	for _, args := range [][]string{
+		{"0"},
+		{"99999999999"},
+		{"--offset", "-1"},
+		{"10", "--offset", "99999999999"},
+	} {
+		err := handlerBrowse(&state{}, command{Name: "browse", Args: args}, database.User{})
+		if err == nil || !strings.Contains(err.Error(), "invalid") {
+			t.Errorf("browse %v: err = %v, want an invalid limit or offset", args, err)
+		}
+	}
+}
@@ -11,13 +11,33 @@ const configFileName = ".gatorconfig.json"
 type Config struct {
 	DBURL           string `json:"db_url"`
 	CurrentUserName string `json:"current_user_name"`
+	APIKey          string `json:"api_key,omitempty"`
+
+	// SMTP server digests are sent through. Edit the config file to set
+	// them; SMTPUsername may be left empty for servers without auth.
+	SMTPHost     string `json:"smtp_host,omitempty"`
+	SMTPPort     int    `json:"smtp_port,omitempty"`
+	SMTPUsername string `json:"smtp_username,omitempty"`
+	SMTPPassword string `json:"smtp_password,omitempty"`
+	SMTPFrom     string `json:"smtp_from,omitempty"`
 }
 
+// SetUser switches the current user. A saved API key belongs to the previous
+// user, so switching to someone else forgets it.
 func (cfg *Config) SetUser(userName string) error {
+	if userName != cfg.CurrentUserName {
+		cfg.APIKey = ""
+	}
 	cfg.CurrentUserName = userName
 	return write(*cfg)
 }
 
+// SetAPIKey saves the API key that authenticates the current user.
+func (cfg *Config) SetAPIKey(key string) error {
+	cfg.APIKey = key
+	return write(*cfg)
+}
+
 func Read() (Config, error) {
 	fullPath, err := getConfigFilePath()
 	if err != nil {
@@ -55,12 +75,20 @@ func write(cfg Config) error {
 		return err
 	}
 
-	file, err := os.Create(fullPath)
+	// The file holds the API key and SMTP password, so only its owner may
+	// read it. The mode given to OpenFile only applies to new files, so
+	// tighten one written by an older version before filling it in.
+	file, err := os.OpenFile(fullPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
 	if err != nil {
 		return err
 	}
 	defer file.Close()
 
+	err = file.Chmod(0600)
+	if err != nil {
+		return err
+	}
+
 	encoder := json.NewEncoder(file)
 	err = encoder.Encode(cfg)
 	if err != nil {
@@ -7,6 +7,7 @@ package database
 
 import (
 	"context"
+	"database/sql"
 	"time"
 
 	"github.com/google/uuid"
@@ -16,10 +17,10 @@ const createFeedFollow = `-- name: CreateFeedFollow :one
 WITH inserted_feed_follow AS (
     INSERT INTO feed_follows (id, created_at, updated_at, user_id, feed_id)
     VALUES ($1, $2, $3, $4, $5)
-    RETURNING id, created_at, updated_at, user_id, feed_id
+    RETURNING id, created_at, updated_at, user_id, feed_id, category
 )
 SELECT
-    inserted_feed_follow.id, inserted_feed_follow.created_at, inserted_feed_follow.updated_at, inserted_feed_follow.user_id, inserted_feed_follow.feed_id,
+    inserted_feed_follow.id, inserted_feed_follow.created_at, inserted_feed_follow.updated_at, inserted_feed_follow.user_id, inserted_feed_follow.feed_id, inserted_feed_follow.category,
     feeds.name AS feed_name,
     users.name AS user_name
 FROM inserted_feed_follow
@@ -41,6 +42,7 @@ type CreateFeedFollowRow struct {
 	UpdatedAt time.Time
 	UserID    uuid.UUID
 	FeedID    uuid.UUID
+	Category  sql.NullString
 	FeedName  string
 	UserName  string
 }
@@ -60,13 +62,14 @@ func (q *Queries) CreateFeedFollow(ctx context.Context, arg CreateFeedFollowPara
 		&i.UpdatedAt,
 		&i.UserID,
 		&i.FeedID,
+		&i.Category,
 		&i.FeedName,
 		&i.UserName,
 	)
 	return i, err
 }
 
-const deleteFeedFollow = `-- name: DeleteFeedFollow :exec
+const deleteFeedFollow = `-- name: DeleteFeedFollow :execrows
 
 DELETE FROM feed_follows WHERE feed_id = $1 AND user_id = $2
 `
@@ -76,14 +79,17 @@ type DeleteFeedFollowParams struct {
 	UserID uuid.UUID
 }
 
-func (q *Queries) DeleteFeedFollow(ctx context.Context, arg DeleteFeedFollowParams) error {
-	_, err := q.db.ExecContext(ctx, deleteFeedFollow, arg.FeedID, arg.UserID)
-	return err
+func (q *Queries) DeleteFeedFollow(ctx context.Context, arg DeleteFeedFollowParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, deleteFeedFollow, arg.FeedID, arg.UserID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
 }
 
 const getFeedFollowsForUser = `-- name: GetFeedFollowsForUser :many
 
-SELECT feed_follows.id, feed_follows.created_at, feed_follows.updated_at, feed_follows.user_id, feed_follows.feed_id, feeds.name AS feed_name, users.name AS user_name
+SELECT feed_follows.id, feed_follows.created_at, feed_follows.updated_at, feed_follows.user_id, feed_follows.feed_id, feed_follows.category, feeds.name AS feed_name, feeds.url AS feed_url, users.name AS user_name
 FROM feed_follows
 INNER JOIN feeds ON feed_follows.feed_id = feeds.id
 INNER JOIN users ON feed_follows.user_id = users.id
@@ -96,7 +102,9 @@ type GetFeedFollowsForUserRow struct {
 	UpdatedAt time.Time
 	UserID    uuid.UUID
 	FeedID    uuid.UUID
+	Category  sql.NullString
 	FeedName  string
+	FeedUrl   string
 	UserName  string
 }
 
@@ -115,7 +123,9 @@ func (q *Queries) GetFeedFollowsForUser(ctx context.Context, userID uuid.UUID) (
 			&i.UpdatedAt,
 			&i.UserID,
 			&i.FeedID,
+			&i.Category,
 			&i.FeedName,
+			&i.FeedUrl,
 			&i.UserName,
 		); err != nil {
 			return nil, err
@@ -130,3 +140,22 @@ func (q *Queries) GetFeedFollowsForUser(ctx context.Context, userID uuid.UUID) (
 	}
 	return items, nil
 }
+
+const setFeedFollowCategory = `-- name: SetFeedFollowCategory :exec
+
+UPDATE feed_follows
+SET category = $3,
+updated_at = NOW()
+WHERE user_id = $1 AND feed_id = $2
+`
+
+type SetFeedFollowCategoryParams struct {
+	UserID   uuid.UUID
+	FeedID   uuid.UUID
+	Category sql.NullString
+}
+
+func (q *Queries) SetFeedFollowCategory(ctx context.Context, arg SetFeedFollowCategoryParams) error {
+	_, err := q.db.ExecContext(ctx, setFeedFollowCategory, arg.UserID, arg.FeedID, arg.Category)
+	return err
+}
@@ -7,24 +7,84 @@ package database
 
 import (
 	"context"
+	"database/sql"
 	"time"
 
 	"github.com/google/uuid"
 )
 
+const claimFeedsToFetch = `-- name: ClaimFeedsToFetch :many
+UPDATE feeds
+SET last_fetched_at = NOW(),
+next_fetch_at = NOW() + fetch_interval_seconds * INTERVAL '1 second',
+updated_at = NOW()
+WHERE id IN (
+    SELECT id FROM feeds
+    WHERE disabled_at IS NULL
+    AND (next_fetch_at IS NULL OR next_fetch_at <= NOW())
+    ORDER BY next_fetch_at ASC NULLS FIRST
+    LIMIT $1
+    FOR UPDATE SKIP LOCKED
+)
+RETURNING id, created_at, updated_at, name, url, user_id, last_fetched_at, etag, last_modified, next_fetch_at, fetch_interval_seconds, last_error, consecutive_failures, last_success_at, disabled_at, max_post_age_seconds, max_posts, public_only
+`
+
+func (q *Queries) ClaimFeedsToFetch(ctx context.Context, maxFeeds int32) ([]Feed, error) {
+	rows, err := q.db.QueryContext(ctx, claimFeedsToFetch, maxFeeds)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Feed
+	for rows.Next() {
+		var i Feed
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Name,
+			&i.Url,
+			&i.UserID,
+			&i.LastFetchedAt,
+			&i.Etag,
+			&i.LastModified,
+			&i.NextFetchAt,
+			&i.FetchIntervalSeconds,
+			&i.LastError,
+			&i.ConsecutiveFailures,
+			&i.LastSuccessAt,
+			&i.DisabledAt,
+			&i.MaxPostAgeSeconds,
+			&i.MaxPosts,
+			&i.PublicOnly,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const createFeed = `-- name: CreateFeed :one
-INSERT INTO feeds (id, created_at, updated_at, name, url, user_id)
-VALUES ($1, $2, $3, $4, $5, $6)
-RETURNING id, created_at, updated_at, name, url, user_id, last_fetched_at
+INSERT INTO feeds (id, created_at, updated_at, name, url, user_id, public_only)
+VALUES ($1, $2, $3, $4, $5, $6, $7)
+RETURNING id, created_at, updated_at, name, url, user_id, last_fetched_at, etag, last_modified, next_fetch_at, fetch_interval_seconds, last_error, consecutive_failures, last_success_at, disabled_at, max_post_age_seconds, max_posts, public_only
 `
 
 type CreateFeedParams struct {
-	ID        uuid.UUID
-	CreatedAt time.Time
-	UpdatedAt time.Time
-	Name      string
-	Url       string
-	UserID    uuid.UUID
+	ID         uuid.UUID
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+	Name       string
+	Url        string
+	UserID     uuid.UUID
+	PublicOnly bool
 }
 
 func (q *Queries) CreateFeed(ctx context.Context, arg CreateFeedParams) (Feed, error) {
@@ -35,7 +95,75 @@ func (q *Queries) CreateFeed(ctx context.Context, arg CreateFeedParams) (Feed, e
 		arg.Name,
 		arg.Url,
 		arg.UserID,
+		arg.PublicOnly,
+	)
+	var i Feed
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Name,
+		&i.Url,
+		&i.UserID,
+		&i.LastFetchedAt,
+		&i.Etag,
+		&i.LastModified,
+		&i.NextFetchAt,
+		&i.FetchIntervalSeconds,
+		&i.LastError,
+		&i.ConsecutiveFailures,
+		&i.LastSuccessAt,
+		&i.DisabledAt,
+		&i.MaxPostAgeSeconds,
+		&i.MaxPosts,
+		&i.PublicOnly,
+	)
+	return i, err
+}
+
+const enableFeed = `-- name: EnableFeed :one
+UPDATE feeds
+SET disabled_at = NULL,
+consecutive_failures = 0,
+next_fetch_at = NULL,
+updated_at = NOW()
+WHERE url = $1
+RETURNING id, created_at, updated_at, name, url, user_id, last_fetched_at, etag, last_modified, next_fetch_at, fetch_interval_seconds, last_error, consecutive_failures, last_success_at, disabled_at, max_post_age_seconds, max_posts, public_only
+`
+
+func (q *Queries) EnableFeed(ctx context.Context, url string) (Feed, error) {
+	row := q.db.QueryRowContext(ctx, enableFeed, url)
+	var i Feed
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Name,
+		&i.Url,
+		&i.UserID,
+		&i.LastFetchedAt,
+		&i.Etag,
+		&i.LastModified,
+		&i.NextFetchAt,
+		&i.FetchIntervalSeconds,
+		&i.LastError,
+		&i.ConsecutiveFailures,
+		&i.LastSuccessAt,
+		&i.DisabledAt,
+		&i.MaxPostAgeSeconds,
+		&i.MaxPosts,
+		&i.PublicOnly,
 	)
+	return i, err
+}
+
+const getFeedByID = `-- name: GetFeedByID :one
+SELECT id, created_at, updated_at, name, url, user_id, last_fetched_at, etag, last_modified, next_fetch_at, fetch_interval_seconds, last_error, consecutive_failures, last_success_at, disabled_at, max_post_age_seconds, max_posts, public_only FROM feeds
+WHERE id = $1
+`
+
+func (q *Queries) GetFeedByID(ctx context.Context, id uuid.UUID) (Feed, error) {
+	row := q.db.QueryRowContext(ctx, getFeedByID, id)
 	var i Feed
 	err := row.Scan(
 		&i.ID,
@@ -45,12 +173,23 @@ func (q *Queries) CreateFeed(ctx context.Context, arg CreateFeedParams) (Feed, e
 		&i.Url,
 		&i.UserID,
 		&i.LastFetchedAt,
+		&i.Etag,
+		&i.LastModified,
+		&i.NextFetchAt,
+		&i.FetchIntervalSeconds,
+		&i.LastError,
+		&i.ConsecutiveFailures,
+		&i.LastSuccessAt,
+		&i.DisabledAt,
+		&i.MaxPostAgeSeconds,
+		&i.MaxPosts,
+		&i.PublicOnly,
 	)
 	return i, err
 }
 
 const getFeedByURL = `-- name: GetFeedByURL :one
-SELECT id, created_at, updated_at, name, url, user_id, last_fetched_at FROM feeds
+SELECT id, created_at, updated_at, name, url, user_id, last_fetched_at, etag, last_modified, next_fetch_at, fetch_interval_seconds, last_error, consecutive_failures, last_success_at, disabled_at, max_post_age_seconds, max_posts, public_only FROM feeds
 WHERE url = $1
 `
 
@@ -65,12 +204,23 @@ func (q *Queries) GetFeedByURL(ctx context.Context, url string) (Feed, error) {
 		&i.Url,
 		&i.UserID,
 		&i.LastFetchedAt,
+		&i.Etag,
+		&i.LastModified,
+		&i.NextFetchAt,
+		&i.FetchIntervalSeconds,
+		&i.LastError,
+		&i.ConsecutiveFailures,
+		&i.LastSuccessAt,
+		&i.DisabledAt,
+		&i.MaxPostAgeSeconds,
+		&i.MaxPosts,
+		&i.PublicOnly,
 	)
 	return i, err
 }
 
 const getFeeds = `-- name: GetFeeds :many
-SELECT id, created_at, updated_at, name, url, user_id, last_fetched_at FROM feeds
+SELECT id, created_at, updated_at, name, url, user_id, last_fetched_at, etag, last_modified, next_fetch_at, fetch_interval_seconds, last_error, consecutive_failures, last_success_at, disabled_at, max_post_age_seconds, max_posts, public_only FROM feeds
 `
 
 func (q *Queries) GetFeeds(ctx context.Context) ([]Feed, error) {
@@ -90,6 +240,17 @@ func (q *Queries) GetFeeds(ctx context.Context) ([]Feed, error) {
 			&i.Url,
 			&i.UserID,
 			&i.LastFetchedAt,
+			&i.Etag,
+			&i.LastModified,
+			&i.NextFetchAt,
+			&i.FetchIntervalSeconds,
+			&i.LastError,
+			&i.ConsecutiveFailures,
+			&i.LastSuccessAt,
+			&i.DisabledAt,
+			&i.MaxPostAgeSeconds,
+			&i.MaxPosts,
+			&i.PublicOnly,
 		); err != nil {
 			return nil, err
 		}
@@ -104,14 +265,87 @@ func (q *Queries) GetFeeds(ctx context.Context) ([]Feed, error) {
 	return items, nil
 }
 
-const getNextFeedToFetch = `-- name: GetNextFeedToFetch :one
-SELECT id, created_at, updated_at, name, url, user_id, last_fetched_at FROM feeds
-ORDER BY last_fetched_at ASC NULLS FIRST
-LIMIT 1
+const listFeeds = `-- name: ListFeeds :many
+SELECT id, created_at, updated_at, name, url, user_id, last_fetched_at, etag, last_modified, next_fetch_at, fetch_interval_seconds, last_error, consecutive_failures, last_success_at, disabled_at, max_post_age_seconds, max_posts, public_only FROM feeds
+ORDER BY created_at, id
+LIMIT $1 OFFSET $2
 `
 
-func (q *Queries) GetNextFeedToFetch(ctx context.Context) (Feed, error) {
-	row := q.db.QueryRowContext(ctx, getNextFeedToFetch)
+type ListFeedsParams struct {
+	Limit  int32
+	Offset int32
+}
+
+func (q *Queries) ListFeeds(ctx context.Context, arg ListFeedsParams) ([]Feed, error) {
+	rows, err := q.db.QueryContext(ctx, listFeeds, arg.Limit, arg.Offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Feed
+	for rows.Next() {
+		var i Feed
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Name,
+			&i.Url,
+			&i.UserID,
+			&i.LastFetchedAt,
+			&i.Etag,
+			&i.LastModified,
+			&i.NextFetchAt,
+			&i.FetchIntervalSeconds,
+			&i.LastError,
+			&i.ConsecutiveFailures,
+			&i.LastSuccessAt,
+			&i.DisabledAt,
+			&i.MaxPostAgeSeconds,
+			&i.MaxPosts,
+			&i.PublicOnly,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const markFeedFailed = `-- name: MarkFeedFailed :one
+UPDATE feeds
+SET last_error = $1,
+consecutive_failures = consecutive_failures + 1,
+next_fetch_at = NOW() + $2::int * INTERVAL '1 second',
+disabled_at = CASE
+    WHEN $3::int > 0 AND consecutive_failures + 1 >= $3::int THEN NOW()
+    ELSE disabled_at
+END,
+updated_at = NOW()
+WHERE id = $4
+RETURNING id, created_at, updated_at, name, url, user_id, last_fetched_at, etag, last_modified, next_fetch_at, fetch_interval_seconds, last_error, consecutive_failures, last_success_at, disabled_at, max_post_age_seconds, max_posts, public_only
+`
+
+type MarkFeedFailedParams struct {
+	LastError    sql.NullString
+	DelaySeconds int32
+	MaxFailures  int32
+	ID           uuid.UUID
+}
+
+func (q *Queries) MarkFeedFailed(ctx context.Context, arg MarkFeedFailedParams) (Feed, error) {
+	row := q.db.QueryRowContext(ctx, markFeedFailed,
+		arg.LastError,
+		arg.DelaySeconds,
+		arg.MaxFailures,
+		arg.ID,
+	)
 	var i Feed
 	err := row.Scan(
 		&i.ID,
@@ -121,20 +355,74 @@ func (q *Queries) GetNextFeedToFetch(ctx context.Context) (Feed, error) {
 		&i.Url,
 		&i.UserID,
 		&i.LastFetchedAt,
+		&i.Etag,
+		&i.LastModified,
+		&i.NextFetchAt,
+		&i.FetchIntervalSeconds,
+		&i.LastError,
+		&i.ConsecutiveFailures,
+		&i.LastSuccessAt,
+		&i.DisabledAt,
+		&i.MaxPostAgeSeconds,
+		&i.MaxPosts,
+		&i.PublicOnly,
 	)
 	return i, err
 }
 
-const markFeedFetched = `-- name: MarkFeedFetched :one
+const markFeedSucceeded = `-- name: MarkFeedSucceeded :exec
 UPDATE feeds
-SET last_fetched_at = NOW(),
+SET last_error = NULL,
+consecutive_failures = 0,
+last_success_at = NOW(),
 updated_at = NOW()
 WHERE id = $1
-RETURNING id, created_at, updated_at, name, url, user_id, last_fetched_at
 `
 
-func (q *Queries) MarkFeedFetched(ctx context.Context, id uuid.UUID) (Feed, error) {
-	row := q.db.QueryRowContext(ctx, markFeedFetched, id)
+func (q *Queries) MarkFeedSucceeded(ctx context.Context, id uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, markFeedSucceeded, id)
+	return err
+}
+
+const releaseFeedClaim = `-- name: ReleaseFeedClaim :exec
+UPDATE feeds
+SET next_fetch_at = NOW(),
+updated_at = NOW()
+WHERE id = $1
+`
+
+func (q *Queries) ReleaseFeedClaim(ctx context.Context, id uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, releaseFeedClaim, id)
+	return err
+}
+
+const setFeedRetention = `-- name: SetFeedRetention :one
+UPDATE feeds
+SET max_post_age_seconds = CASE WHEN $1::bool
+    THEN $2::int ELSE max_post_age_seconds END,
+max_posts = CASE WHEN $3::bool
+    THEN $4::int ELSE max_posts END,
+updated_at = NOW()
+WHERE url = $5
+RETURNING id, created_at, updated_at, name, url, user_id, last_fetched_at, etag, last_modified, next_fetch_at, fetch_interval_seconds, last_error, consecutive_failures, last_success_at, disabled_at, max_post_age_seconds, max_posts, public_only
+`
+
+type SetFeedRetentionParams struct {
+	SetMaxAge         bool
+	MaxPostAgeSeconds sql.NullInt32
+	SetMaxPosts       bool
+	MaxPosts          sql.NullInt32
+	Url               string
+}
+
+func (q *Queries) SetFeedRetention(ctx context.Context, arg SetFeedRetentionParams) (Feed, error) {
+	row := q.db.QueryRowContext(ctx, setFeedRetention,
+		arg.SetMaxAge,
+		arg.MaxPostAgeSeconds,
+		arg.SetMaxPosts,
+		arg.MaxPosts,
+		arg.Url,
+	)
 	var i Feed
 	err := row.Scan(
 		&i.ID,
@@ -144,6 +432,55 @@ func (q *Queries) MarkFeedFetched(ctx context.Context, id uuid.UUID) (Feed, erro
 		&i.Url,
 		&i.UserID,
 		&i.LastFetchedAt,
+		&i.Etag,
+		&i.LastModified,
+		&i.NextFetchAt,
+		&i.FetchIntervalSeconds,
+		&i.LastError,
+		&i.ConsecutiveFailures,
+		&i.LastSuccessAt,
+		&i.DisabledAt,
+		&i.MaxPostAgeSeconds,
+		&i.MaxPosts,
+		&i.PublicOnly,
 	)
 	return i, err
 }
+
+const updateFeedSchedule = `-- name: UpdateFeedSchedule :exec
+UPDATE feeds
+SET next_fetch_at = NOW() + $1::int * INTERVAL '1 second',
+fetch_interval_seconds = $2,
+updated_at = NOW()
+WHERE id = $3
+`
+
+type UpdateFeedScheduleParams struct {
+	DelaySeconds         int32
+	FetchIntervalSeconds int32
+	ID                   uuid.UUID
+}
+
+func (q *Queries) UpdateFeedSchedule(ctx context.Context, arg UpdateFeedScheduleParams) error {
+	_, err := q.db.ExecContext(ctx, updateFeedSchedule, arg.DelaySeconds, arg.FetchIntervalSeconds, arg.ID)
+	return err
+}
+
+const updateFeedValidators = `-- name: UpdateFeedValidators :exec
+UPDATE feeds
+SET etag = $2,
+last_modified = $3,
+updated_at = NOW()
+WHERE id = $1
+`
+
+type UpdateFeedValidatorsParams struct {
+	ID           uuid.UUID
+	Etag         sql.NullString
+	LastModified sql.NullString
+}
+
+func (q *Queries) UpdateFeedValidators(ctx context.Context, arg UpdateFeedValidatorsParams) error {
+	_, err := q.db.ExecContext(ctx, updateFeedValidators, arg.ID, arg.Etag, arg.LastModified)
+	return err
+}
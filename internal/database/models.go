@@ -6,19 +6,60 @@ package database
 
 import (
 	"database/sql"
+	"encoding/json"
 	"time"
 
 	"github.com/google/uuid"
 )
 
+type ApiKey struct {
+	ID         uuid.UUID
+	CreatedAt  time.Time
+	UserID     uuid.UUID
+	Name       string
+	Prefix     string
+	KeyHash    string
+	LastUsedAt sql.NullTime
+	RevokedAt  sql.NullTime
+}
+
+type Digest struct {
+	ID          uuid.UUID
+	SentAt      time.Time
+	UserID      uuid.UUID
+	Email       string
+	WindowStart time.Time
+	WindowEnd   time.Time
+	PostCount   int32
+}
+
+type DigestSubscription struct {
+	UserID    uuid.UUID
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	Email     string
+	Frequency string
+}
+
 type Feed struct {
-	ID            uuid.UUID
-	CreatedAt     time.Time
-	UpdatedAt     time.Time
-	Name          string
-	Url           string
-	UserID        uuid.UUID
-	LastFetchedAt sql.NullTime
+	ID                   uuid.UUID
+	CreatedAt            time.Time
+	UpdatedAt            time.Time
+	Name                 string
+	Url                  string
+	UserID               uuid.UUID
+	LastFetchedAt        sql.NullTime
+	Etag                 sql.NullString
+	LastModified         sql.NullString
+	NextFetchAt          sql.NullTime
+	FetchIntervalSeconds int32
+	LastError            sql.NullString
+	ConsecutiveFailures  int32
+	LastSuccessAt        sql.NullTime
+	DisabledAt           sql.NullTime
+	MaxPostAgeSeconds    sql.NullInt32
+	MaxPosts             sql.NullInt32
+	PublicOnly           bool
 }
 
 type FeedFollow struct {
@@ -27,6 +68,7 @@ type FeedFollow struct {
 	UpdatedAt time.Time
 	UserID    uuid.UUID
 	FeedID    uuid.UUID
+	Category  sql.NullString
 }
 
 type Post struct {
@@ -38,6 +80,20 @@ type Post struct {
 	Description sql.NullString
 	PublishedAt sql.NullTime
 	FeedID      uuid.UUID
+	Guid        string
+	Search      interface{}
+	ItemID      int64
+	Author      sql.NullString
+}
+
+type Rule struct {
+	ID        uuid.UUID
+	CreatedAt time.Time
+	UserID    uuid.UUID
+	Field     string
+	MatchType string
+	Pattern   string
+	Action    string
 }
 
 type User struct {
@@ -46,3 +102,41 @@ type User struct {
 	UpdatedAt time.Time
 	Name      string
 }
+
+type UserPostStar struct {
+	UserID    uuid.UUID
+	PostID    uuid.UUID
+	CreatedAt time.Time
+}
+
+type UserPostState struct {
+	UserID uuid.UUID
+	PostID uuid.UUID
+	Read   bool
+	ReadAt sql.NullTime
+	Hidden bool
+}
+
+type Webhook struct {
+	ID        uuid.UUID
+	CreatedAt time.Time
+	UserID    uuid.UUID
+	FeedID    uuid.NullUUID
+	Url       string
+	Secret    string
+}
+
+type WebhookDelivery struct {
+	ID            uuid.UUID
+	CreatedAt     time.Time
+	WebhookID     uuid.UUID
+	PostID        uuid.UUID
+	Payload       json.RawMessage
+	Attempts      int32
+	NextAttemptAt time.Time
+	DeliveredAt   sql.NullTime
+	FailedAt      sql.NullTime
+	LastStatus    sql.NullInt32
+	LastError     sql.NullString
+	Event         string
+}
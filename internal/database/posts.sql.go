@@ -13,13 +13,195 @@ import (
 	"github.com/google/uuid"
 )
 
-const createPost = `-- name: CreatePost :one
-INSERT INTO posts (id, created_at, updated_at, title, url, description, published_at, feed_id)
-VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
-RETURNING id, created_at, updated_at, title, url, description, published_at, feed_id
+const countPrunablePosts = `-- name: CountPrunablePosts :many
+
+WITH ranked AS (
+    SELECT
+        posts.id,
+        posts.feed_id,
+        posts.published_at,
+        ROW_NUMBER() OVER (
+            PARTITION BY posts.feed_id
+            ORDER BY posts.published_at DESC NULLS LAST, posts.created_at DESC
+        ) AS position
+    FROM posts
+),
+prunable AS (
+    SELECT ranked.id, ranked.feed_id FROM ranked
+    JOIN feeds ON ranked.feed_id = feeds.id
+    WHERE (
+        (
+            COALESCE(feeds.max_post_age_seconds, $1::int) > 0
+            AND ranked.published_at < (NOW() AT TIME ZONE 'UTC')
+                - COALESCE(feeds.max_post_age_seconds, $1::int) * INTERVAL '1 second'
+        )
+        OR (
+            feeds.max_posts IS NOT NULL
+            AND ranked.position > feeds.max_posts
+            AND NOT EXISTS (
+                SELECT 1 FROM feed_follows
+                LEFT JOIN user_post_states ON user_post_states.post_id = ranked.id
+                    AND user_post_states.user_id = feed_follows.user_id
+                WHERE feed_follows.feed_id = ranked.feed_id
+                AND user_post_states.read IS NOT TRUE
+                AND user_post_states.hidden IS NOT TRUE
+            )
+        )
+    )
+    AND NOT EXISTS (
+        SELECT 1 FROM user_post_stars
+        WHERE user_post_stars.post_id = ranked.id
+    )
+)
+SELECT feeds.name AS feed_name, feeds.url AS feed_url, COUNT(*) AS post_count FROM prunable
+JOIN feeds ON prunable.feed_id = feeds.id
+GROUP BY feeds.id
+ORDER BY feeds.name, feeds.url
+`
+
+type CountPrunablePostsRow struct {
+	FeedName  string
+	FeedUrl   string
+	PostCount int64
+}
+
+func (q *Queries) CountPrunablePosts(ctx context.Context, defaultMaxAgeSeconds int32) ([]CountPrunablePostsRow, error) {
+	rows, err := q.db.QueryContext(ctx, countPrunablePosts, defaultMaxAgeSeconds)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []CountPrunablePostsRow
+	for rows.Next() {
+		var i CountPrunablePostsRow
+		if err := rows.Scan(&i.FeedName, &i.FeedUrl, &i.PostCount); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const deletePrunablePosts = `-- name: DeletePrunablePosts :many
+
+WITH ranked AS (
+    SELECT
+        posts.id,
+        posts.feed_id,
+        posts.published_at,
+        ROW_NUMBER() OVER (
+            PARTITION BY posts.feed_id
+            ORDER BY posts.published_at DESC NULLS LAST, posts.created_at DESC
+        ) AS position
+    FROM posts
+),
+prunable AS (
+    SELECT ranked.id, ranked.feed_id FROM ranked
+    JOIN feeds ON ranked.feed_id = feeds.id
+    WHERE (
+        (
+            COALESCE(feeds.max_post_age_seconds, $1::int) > 0
+            AND ranked.published_at < (NOW() AT TIME ZONE 'UTC')
+                - COALESCE(feeds.max_post_age_seconds, $1::int) * INTERVAL '1 second'
+        )
+        OR (
+            feeds.max_posts IS NOT NULL
+            AND ranked.position > feeds.max_posts
+            AND NOT EXISTS (
+                SELECT 1 FROM feed_follows
+                LEFT JOIN user_post_states ON user_post_states.post_id = ranked.id
+                    AND user_post_states.user_id = feed_follows.user_id
+                WHERE feed_follows.feed_id = ranked.feed_id
+                AND user_post_states.read IS NOT TRUE
+                AND user_post_states.hidden IS NOT TRUE
+            )
+        )
+    )
+    AND NOT EXISTS (
+        SELECT 1 FROM user_post_stars
+        WHERE user_post_stars.post_id = ranked.id
+    )
+),
+deleted AS (
+    DELETE FROM posts
+    WHERE posts.id IN (SELECT prunable.id FROM prunable)
+    RETURNING posts.feed_id
+)
+SELECT feeds.name AS feed_name, feeds.url AS feed_url, COUNT(*) AS post_count FROM deleted
+JOIN feeds ON deleted.feed_id = feeds.id
+GROUP BY feeds.id
+ORDER BY feeds.name, feeds.url
 `
 
-type CreatePostParams struct {
+type DeletePrunablePostsRow struct {
+	FeedName  string
+	FeedUrl   string
+	PostCount int64
+}
+
+func (q *Queries) DeletePrunablePosts(ctx context.Context, defaultMaxAgeSeconds int32) ([]DeletePrunablePostsRow, error) {
+	rows, err := q.db.QueryContext(ctx, deletePrunablePosts, defaultMaxAgeSeconds)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []DeletePrunablePostsRow
+	for rows.Next() {
+		var i DeletePrunablePostsRow
+		if err := rows.Scan(&i.FeedName, &i.FeedUrl, &i.PostCount); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getFilteredPostsForUser = `-- name: GetFilteredPostsForUser :many
+
+SELECT posts.id, posts.created_at, posts.updated_at, posts.title, posts.url, posts.description, posts.published_at, posts.feed_id, posts.guid, posts.search, posts.item_id, posts.author, feeds.name AS feed_name, feeds.url AS feed_url FROM posts
+JOIN feed_follows ON feed_follows.feed_id = posts.feed_id
+JOIN feeds ON posts.feed_id = feeds.id
+LEFT JOIN user_post_states ON user_post_states.post_id = posts.id
+    AND user_post_states.user_id = feed_follows.user_id
+WHERE feed_follows.user_id = $1
+AND ($2::bool OR user_post_states.read IS NOT TRUE)
+AND ($3::bool OR user_post_states.hidden IS NOT TRUE)
+AND ($4::uuid IS NULL OR posts.feed_id = $4::uuid)
+AND ($5::timestamp IS NULL OR posts.published_at >= $5::timestamp)
+AND ($6::timestamp IS NULL OR posts.published_at < $6::timestamp)
+ORDER BY
+    CASE WHEN $7::bool THEN posts.published_at END ASC,
+    CASE WHEN NOT $7::bool THEN posts.published_at END DESC,
+    posts.id
+LIMIT $9
+OFFSET $8
+`
+
+type GetFilteredPostsForUserParams struct {
+	UserID        uuid.UUID
+	IncludeRead   bool
+	IncludeHidden bool
+	FeedID        uuid.NullUUID
+	Since         sql.NullTime
+	Until         sql.NullTime
+	OldestFirst   bool
+	SkipPosts     int32
+	MaxPosts      int32
+}
+
+type GetFilteredPostsForUserRow struct {
 	ID          uuid.UUID
 	CreatedAt   time.Time
 	UpdatedAt   time.Time
@@ -28,39 +210,147 @@ type CreatePostParams struct {
 	Description sql.NullString
 	PublishedAt sql.NullTime
 	FeedID      uuid.UUID
+	Guid        string
+	Search      interface{}
+	ItemID      int64
+	Author      sql.NullString
+	FeedName    string
+	FeedUrl     string
 }
 
-func (q *Queries) CreatePost(ctx context.Context, arg CreatePostParams) (Post, error) {
-	row := q.db.QueryRowContext(ctx, createPost,
-		arg.ID,
-		arg.CreatedAt,
-		arg.UpdatedAt,
-		arg.Title,
-		arg.Url,
-		arg.Description,
-		arg.PublishedAt,
+func (q *Queries) GetFilteredPostsForUser(ctx context.Context, arg GetFilteredPostsForUserParams) ([]GetFilteredPostsForUserRow, error) {
+	rows, err := q.db.QueryContext(ctx, getFilteredPostsForUser,
+		arg.UserID,
+		arg.IncludeRead,
+		arg.IncludeHidden,
 		arg.FeedID,
+		arg.Since,
+		arg.Until,
+		arg.OldestFirst,
+		arg.SkipPosts,
+		arg.MaxPosts,
 	)
-	var i Post
-	err := row.Scan(
-		&i.ID,
-		&i.CreatedAt,
-		&i.UpdatedAt,
-		&i.Title,
-		&i.Url,
-		&i.Description,
-		&i.PublishedAt,
-		&i.FeedID,
-	)
-	return i, err
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetFilteredPostsForUserRow
+	for rows.Next() {
+		var i GetFilteredPostsForUserRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Title,
+			&i.Url,
+			&i.Description,
+			&i.PublishedAt,
+			&i.FeedID,
+			&i.Guid,
+			&i.Search,
+			&i.ItemID,
+			&i.Author,
+			&i.FeedName,
+			&i.FeedUrl,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getPostsForFeed = `-- name: GetPostsForFeed :many
+
+SELECT posts.id, posts.created_at, posts.updated_at, posts.title, posts.url, posts.description, posts.published_at, posts.feed_id, posts.guid, posts.search, posts.item_id, posts.author, feeds.name AS feed_name, feeds.url AS feed_url FROM posts
+JOIN feeds ON posts.feed_id = feeds.id
+WHERE posts.feed_id = $1
+AND NOT EXISTS (
+    SELECT 1 FROM user_post_states
+    WHERE user_post_states.post_id = posts.id
+    AND user_post_states.user_id = $3
+    AND user_post_states.hidden
+)
+ORDER BY posts.published_at DESC
+LIMIT $2
+`
+
+type GetPostsForFeedParams struct {
+	FeedID uuid.UUID
+	Limit  int32
+	UserID uuid.UUID
+}
+
+type GetPostsForFeedRow struct {
+	ID          uuid.UUID
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+	Title       string
+	Url         string
+	Description sql.NullString
+	PublishedAt sql.NullTime
+	FeedID      uuid.UUID
+	Guid        string
+	Search      interface{}
+	ItemID      int64
+	Author      sql.NullString
+	FeedName    string
+	FeedUrl     string
+}
+
+func (q *Queries) GetPostsForFeed(ctx context.Context, arg GetPostsForFeedParams) ([]GetPostsForFeedRow, error) {
+	rows, err := q.db.QueryContext(ctx, getPostsForFeed, arg.FeedID, arg.Limit, arg.UserID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetPostsForFeedRow
+	for rows.Next() {
+		var i GetPostsForFeedRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Title,
+			&i.Url,
+			&i.Description,
+			&i.PublishedAt,
+			&i.FeedID,
+			&i.Guid,
+			&i.Search,
+			&i.ItemID,
+			&i.Author,
+			&i.FeedName,
+			&i.FeedUrl,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
 }
 
 const getPostsForUser = `-- name: GetPostsForUser :many
 
-SELECT posts.id, posts.created_at, posts.updated_at, posts.title, posts.url, posts.description, posts.published_at, posts.feed_id, feeds.name AS feed_name FROM posts
+SELECT posts.id, posts.created_at, posts.updated_at, posts.title, posts.url, posts.description, posts.published_at, posts.feed_id, posts.guid, posts.search, posts.item_id, posts.author, feeds.name AS feed_name, feeds.url AS feed_url FROM posts
 JOIN feed_follows ON feed_follows.feed_id = posts.feed_id
 JOIN feeds ON posts.feed_id = feeds.id
+LEFT JOIN user_post_states ON user_post_states.post_id = posts.id
+    AND user_post_states.user_id = feed_follows.user_id
 WHERE feed_follows.user_id = $1
+AND user_post_states.hidden IS NOT TRUE
 ORDER BY posts.published_at DESC
 LIMIT $2
 `
@@ -79,7 +369,12 @@ type GetPostsForUserRow struct {
 	Description sql.NullString
 	PublishedAt sql.NullTime
 	FeedID      uuid.UUID
+	Guid        string
+	Search      interface{}
+	ItemID      int64
+	Author      sql.NullString
 	FeedName    string
+	FeedUrl     string
 }
 
 func (q *Queries) GetPostsForUser(ctx context.Context, arg GetPostsForUserParams) ([]GetPostsForUserRow, error) {
@@ -100,7 +395,126 @@ func (q *Queries) GetPostsForUser(ctx context.Context, arg GetPostsForUserParams
 			&i.Description,
 			&i.PublishedAt,
 			&i.FeedID,
+			&i.Guid,
+			&i.Search,
+			&i.ItemID,
+			&i.Author,
+			&i.FeedName,
+			&i.FeedUrl,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const rekeyLegacyPost = `-- name: RekeyLegacyPost :execrows
+
+UPDATE posts
+SET guid = $1
+WHERE posts.feed_id = $2
+AND posts.url = $3
+AND posts.guid = posts.url
+AND NOT EXISTS (
+    SELECT 1 FROM posts AS keyed
+    WHERE keyed.feed_id = $2
+    AND keyed.guid = $1
+)
+`
+
+type RekeyLegacyPostParams struct {
+	Guid   string
+	FeedID uuid.UUID
+	Url    string
+}
+
+func (q *Queries) RekeyLegacyPost(ctx context.Context, arg RekeyLegacyPostParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, rekeyLegacyPost, arg.Guid, arg.FeedID, arg.Url)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const searchPosts = `-- name: SearchPosts :many
+
+SELECT
+    posts.id,
+    posts.title,
+    posts.url,
+    posts.published_at,
+    feeds.name AS feed_name,
+    ts_rank(posts.search, query) AS rank,
+    ts_headline(
+        'english',
+        coalesce(posts.description, posts.title),
+        query,
+        'MaxFragments=2, MinWords=5, MaxWords=20, StartSel=**, StopSel=**'
+    )::text AS headline
+FROM posts
+JOIN feeds ON posts.feed_id = feeds.id,
+to_tsquery('english', $1) query
+WHERE posts.search @@ query
+AND ($2::uuid IS NULL OR posts.feed_id IN (
+    SELECT feed_follows.feed_id FROM feed_follows
+    WHERE feed_follows.user_id = $2::uuid
+))
+AND NOT EXISTS (
+    SELECT 1 FROM user_post_states
+    WHERE user_post_states.post_id = posts.id
+    AND user_post_states.user_id = $3::uuid
+    AND user_post_states.hidden
+)
+ORDER BY rank DESC, posts.published_at DESC
+LIMIT $4
+`
+
+type SearchPostsParams struct {
+	Query      string
+	UserID     uuid.NullUUID
+	ViewerID   uuid.UUID
+	MaxResults int32
+}
+
+type SearchPostsRow struct {
+	ID          uuid.UUID
+	Title       string
+	Url         string
+	PublishedAt sql.NullTime
+	FeedName    string
+	Rank        float32
+	Headline    string
+}
+
+func (q *Queries) SearchPosts(ctx context.Context, arg SearchPostsParams) ([]SearchPostsRow, error) {
+	rows, err := q.db.QueryContext(ctx, searchPosts,
+		arg.Query,
+		arg.UserID,
+		arg.ViewerID,
+		arg.MaxResults,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []SearchPostsRow
+	for rows.Next() {
+		var i SearchPostsRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.Title,
+			&i.Url,
+			&i.PublishedAt,
 			&i.FeedName,
+			&i.Rank,
+			&i.Headline,
 		); err != nil {
 			return nil, err
 		}
@@ -114,3 +528,63 @@ func (q *Queries) GetPostsForUser(ctx context.Context, arg GetPostsForUserParams
 	}
 	return items, nil
 }
+
+const upsertPost = `-- name: UpsertPost :one
+INSERT INTO posts (id, created_at, updated_at, title, url, description, published_at, feed_id, guid, author)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+ON CONFLICT (feed_id, guid) DO UPDATE
+SET title = EXCLUDED.title,
+url = EXCLUDED.url,
+description = EXCLUDED.description,
+author = EXCLUDED.author,
+updated_at = EXCLUDED.updated_at
+WHERE posts.title IS DISTINCT FROM EXCLUDED.title
+OR posts.url IS DISTINCT FROM EXCLUDED.url
+OR posts.description IS DISTINCT FROM EXCLUDED.description
+OR posts.author IS DISTINCT FROM EXCLUDED.author
+RETURNING id, created_at, updated_at, title, url, description, published_at, feed_id, guid, search, item_id, author
+`
+
+type UpsertPostParams struct {
+	ID          uuid.UUID
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+	Title       string
+	Url         string
+	Description sql.NullString
+	PublishedAt sql.NullTime
+	FeedID      uuid.UUID
+	Guid        string
+	Author      sql.NullString
+}
+
+func (q *Queries) UpsertPost(ctx context.Context, arg UpsertPostParams) (Post, error) {
+	row := q.db.QueryRowContext(ctx, upsertPost,
+		arg.ID,
+		arg.CreatedAt,
+		arg.UpdatedAt,
+		arg.Title,
+		arg.Url,
+		arg.Description,
+		arg.PublishedAt,
+		arg.FeedID,
+		arg.Guid,
+		arg.Author,
+	)
+	var i Post
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Title,
+		&i.Url,
+		&i.Description,
+		&i.PublishedAt,
+		&i.FeedID,
+		&i.Guid,
+		&i.Search,
+		&i.ItemID,
+		&i.Author,
+	)
+	return i, err
+}
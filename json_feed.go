@@ -0,0 +1,131 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"slices"
+	"strings"
+)
+
+// JSONFeed is a JSON Feed 1.1 document (https://www.jsonfeed.org/version/1.1/).
+type JSONFeed struct {
+	Version     string           `json:"version"`
+	Title       string           `json:"title"`
+	HomePageURL string           `json:"home_page_url"`
+	FeedURL     string           `json:"feed_url"`
+	Description string           `json:"description"`
+	Authors     []JSONFeedAuthor `json:"authors"`
+	Author      *JSONFeedAuthor  `json:"author"`
+	Items       []JSONFeedItem   `json:"items"`
+}
+
+type JSONFeedItem struct {
+	ID            jsonFeedID       `json:"id"`
+	URL           string           `json:"url"`
+	ExternalURL   string           `json:"external_url"`
+	Title         string           `json:"title"`
+	ContentHTML   string           `json:"content_html"`
+	ContentText   string           `json:"content_text"`
+	Summary       string           `json:"summary"`
+	DatePublished string           `json:"date_published"`
+	DateModified  string           `json:"date_modified"`
+	Authors       []JSONFeedAuthor `json:"authors"`
+	Author        *JSONFeedAuthor  `json:"author"`
+}
+
+// JSONFeedAuthor is an entry in authors, or JSON Feed 1.0's single author.
+type JSONFeedAuthor struct {
+	Name string `json:"name"`
+}
+
+// jsonFeedAuthorNames joins the names of a 1.1 authors list, falling back to
+// a 1.0 author.
+func jsonFeedAuthorNames(authors []JSONFeedAuthor, author *JSONFeedAuthor) string {
+	if author != nil {
+		authors = append(authors, *author)
+	}
+	var names []string
+	for _, a := range authors {
+		if name := strings.TrimSpace(a.Name); name != "" && !slices.Contains(names, name) {
+			names = append(names, name)
+		}
+	}
+	return strings.Join(names, ", ")
+}
+
+// jsonFeedID is a string per the spec, but JSON Feed 1.0 publishers often
+// emit numbers, so both are accepted.
+type jsonFeedID string
+
+func (id *jsonFeedID) UnmarshalJSON(dat []byte) error {
+	var s string
+	if err := json.Unmarshal(dat, &s); err == nil {
+		*id = jsonFeedID(s)
+		return nil
+	}
+	var n json.Number
+	if err := json.Unmarshal(dat, &n); err != nil {
+		return err
+	}
+	*id = jsonFeedID(n.String())
+	return nil
+}
+
+type jsonFeedFormat struct{}
+
+// matches sniffs the body rather than trusting the Content-Type, since
+// plenty of servers send JSON Feeds as text/plain or
+// application/octet-stream, and a JSON Feed is always a JSON object.
+func (jsonFeedFormat) matches(root xml.Name, dat []byte) bool {
+	return bytes.HasPrefix(bytes.TrimSpace(bytes.TrimPrefix(dat, utf8BOM)), []byte("{"))
+}
+
+// utf8BOM is the byte order mark some servers put in front of UTF-8 bodies,
+// which encoding/json rejects.
+var utf8BOM = []byte("\xef\xbb\xbf")
+
+func (jsonFeedFormat) parse(dat []byte) (*RSSFeed, error) {
+	var jsonFeed JSONFeed
+	err := json.Unmarshal(bytes.TrimPrefix(dat, utf8BOM), &jsonFeed)
+	if err != nil {
+		return nil, err
+	}
+
+	rssFeed := &RSSFeed{}
+	rssFeed.Channel.Title = jsonFeed.Title
+	rssFeed.Channel.Link = jsonFeed.HomePageURL
+	rssFeed.Channel.Description = jsonFeed.Description
+	for _, item := range jsonFeed.Items {
+		link := item.URL
+		if link == "" {
+			link = item.ExternalURL
+		}
+
+		description := item.Summary
+		if description == "" {
+			description = item.ContentHTML
+		}
+		if description == "" {
+			description = item.ContentText
+		}
+
+		// Items without an author inherit the feed's.
+		author := jsonFeedAuthorNames(item.Authors, item.Author)
+		if author == "" {
+			author = jsonFeedAuthorNames(jsonFeed.Authors, jsonFeed.Author)
+		}
+
+		rssFeed.Channel.Item = append(rssFeed.Channel.Item, RSSItem{
+			Title:       item.Title,
+			Link:        link,
+			Description: description,
+			PubDate:     item.DatePublished,
+			GUID:        string(item.ID),
+			Updated:     item.DateModified,
+			DCCreator:   author,
+		})
+	}
+
+	return rssFeed, nil
+}
@@ -3,6 +3,8 @@ package main
 import (
 	"context"
 	"database/sql"
+	"errors"
+	"fmt"
 	"log"
 	"os"
 
@@ -13,8 +15,9 @@ import (
 )
 
 type state struct {
-	db  *database.Queries
-	cfg *config.Config
+	db   *database.Queries
+	conn *sql.DB
+	cfg  *config.Config
 }
 
 func main() {
@@ -31,8 +34,9 @@ func main() {
 	dbQueries := database.New(db)
 
 	programState := &state{
-		db:  dbQueries,
-		cfg: &cfg,
+		db:   dbQueries,
+		conn: db,
+		cfg:  &cfg,
 	}
 
 	cmds := commands{
@@ -46,10 +50,27 @@ func main() {
 	cmds.register("agg", handlerAgg)
 	cmds.register("addfeed", middlewareLoggedIn(handlerAddFeed))
 	cmds.register("feeds", handlerListFeeds)
+	cmds.register("enablefeed", handlerEnableFeed)
+	cmds.register("retention", handlerRetention)
+	cmds.register("prune", handlerPrune)
 	cmds.register("follow", middlewareLoggedIn(handlerFollow))
 	cmds.register("following", middlewareLoggedIn(handlerListFeedFollows))
 	cmds.register("unfollow", middlewareLoggedIn(handlerUnfollow))
 	cmds.register("browse", middlewareLoggedIn(handlerBrowse))
+	cmds.register("read", middlewareLoggedIn(handlerRead))
+	cmds.register("unread", middlewareLoggedIn(handlerUnread))
+	cmds.register("star", middlewareLoggedIn(handlerStar))
+	cmds.register("unstar", middlewareLoggedIn(handlerUnstar))
+	cmds.register("starred", middlewareLoggedIn(handlerStarred))
+	cmds.register("search", middlewareLoggedIn(handlerSearch))
+	cmds.register("import", middlewareLoggedIn(handlerImport))
+	cmds.register("export", middlewareLoggedIn(handlerExport))
+	cmds.register("render", middlewareLoggedIn(handlerRender))
+	cmds.register("apikey", middlewareLoggedIn(handlerAPIKey))
+	cmds.register("webhook", middlewareLoggedIn(handlerWebhook))
+	cmds.register("digest", middlewareLoggedIn(handlerDigest))
+	cmds.register("rule", middlewareLoggedIn(handlerRule))
+	cmds.register("serve", handlerServe)
 
 	if len(os.Args) < 2 {
 		log.Fatal("Usage: cli <command> [args...]")
@@ -67,6 +88,17 @@ func main() {
 
 func middlewareLoggedIn(handler func(s *state, cmd command, user database.User) error) func(*state, command) error {
 	return func(s *state, cmd command) error {
+		if s.cfg.APIKey != "" {
+			user, err := s.db.GetUserByAPIKey(context.Background(), hashAPIKey(s.cfg.APIKey))
+			if errors.Is(err, sql.ErrNoRows) {
+				return errors.New("the API key in the config file is invalid or revoked")
+			}
+			if err != nil {
+				return fmt.Errorf("couldn't get user: %w", err)
+			}
+			return handler(s, cmd, user)
+		}
+
 		user, err := s.db.GetUser(context.Background(), s.cfg.CurrentUserName)
 		if err != nil {
 			return err
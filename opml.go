@@ -0,0 +1,281 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/VuTLy/blogAggregator/internal/database"
+	"github.com/google/uuid"
+)
+
+type OPML struct {
+	XMLName xml.Name `xml:"opml"`
+	Version string   `xml:"version,attr"`
+	Head    OPMLHead `xml:"head"`
+	Body    OPMLBody `xml:"body"`
+}
+
+type OPMLHead struct {
+	Title       string `xml:"title"`
+	DateCreated string `xml:"dateCreated,omitempty"`
+}
+
+type OPMLBody struct {
+	Outline []OPMLOutline `xml:"outline"`
+}
+
+// OPMLOutline is either a folder, holding nested outlines, or a feed
+// subscription with an xmlUrl.
+type OPMLOutline struct {
+	Text     string        `xml:"text,attr"`
+	Title    string        `xml:"title,attr,omitempty"`
+	Type     string        `xml:"type,attr,omitempty"`
+	XMLURL   string        `xml:"xmlUrl,attr,omitempty"`
+	HTMLURL  string        `xml:"htmlUrl,attr,omitempty"`
+	Category string        `xml:"category,attr,omitempty"`
+	Outline  []OPMLOutline `xml:"outline"`
+}
+
+// opmlFeed is a subscription flattened out of an OPML document, with its
+// folder path joined by "/" as the category.
+type opmlFeed struct {
+	Name     string
+	URL      string
+	Category string
+}
+
+func flattenOutlines(outlines []OPMLOutline, folders []string) []opmlFeed {
+	var feeds []opmlFeed
+	for _, outline := range outlines {
+		name := strings.TrimSpace(outline.Title)
+		if name == "" {
+			name = strings.TrimSpace(outline.Text)
+		}
+
+		// An outline with a blank xmlUrl is a folder, or skipped if it's
+		// empty.
+		feedURL := strings.TrimSpace(outline.XMLURL)
+		if feedURL == "" {
+			feeds = append(feeds, flattenOutlines(outline.Outline, append(folders[:len(folders):len(folders)], name))...)
+			continue
+		}
+
+		category := strings.Join(folders, "/")
+		if category == "" && outline.Category != "" {
+			// OPML 2.0 categories are comma-separated slash paths.
+			category = strings.Trim(strings.Split(outline.Category, ",")[0], "/ ")
+		}
+		if name == "" {
+			name = feedURL
+		}
+		feeds = append(feeds, opmlFeed{
+			Name:     name,
+			URL:      feedURL,
+			Category: category,
+		})
+	}
+	return feeds
+}
+
+func handlerImport(s *state, cmd command, user database.User) error {
+	if len(cmd.Args) != 1 {
+		return fmt.Errorf("usage: %s <file.opml>", cmd.Name)
+	}
+
+	dat, err := os.ReadFile(cmd.Args[0])
+	if err != nil {
+		return fmt.Errorf("couldn't read OPML file: %w", err)
+	}
+
+	var opml OPML
+	err = xml.Unmarshal(dat, &opml)
+	if err != nil {
+		return fmt.Errorf("couldn't parse OPML file: %w", err)
+	}
+
+	feedFollows, err := s.db.GetFeedFollowsForUser(context.Background(), user.ID)
+	if err != nil {
+		return fmt.Errorf("couldn't get feed follows: %w", err)
+	}
+	following := map[uuid.UUID]bool{}
+	for _, ff := range feedFollows {
+		following[ff.FeedID] = true
+	}
+
+	entries := flattenOutlines(opml.Body.Outline, nil)
+	failed := 0
+	for _, entry := range entries {
+		result, err := importFeed(s, user, entry, following)
+		if err != nil {
+			failed++
+			fmt.Printf("✗ %s (%s): %v\n", entry.Name, entry.URL, err)
+			continue
+		}
+		fmt.Printf("✓ %s (%s): %s\n", entry.Name, entry.URL, result)
+	}
+
+	fmt.Printf("Imported %d of %d feeds, %d failed.\n", len(entries)-failed, len(entries), failed)
+	return nil
+}
+
+// importFeed creates entry's feed if needed, follows it for user and files
+// it under its category, returning a description of what it did. It does all
+// of that in one transaction, so a failure doesn't leave a feed nobody
+// follows.
+func importFeed(s *state, user database.User, entry opmlFeed, following map[uuid.UUID]bool) (string, error) {
+	var actions []string
+
+	ctx := context.Background()
+	tx, err := s.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return "", fmt.Errorf("couldn't begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+	qtx := s.db.WithTx(tx)
+
+	feed, err := qtx.GetFeedByURL(ctx, entry.URL)
+	if errors.Is(err, sql.ErrNoRows) {
+		feed, err = qtx.CreateFeed(ctx, database.CreateFeedParams{
+			ID:        uuid.New(),
+			CreatedAt: time.Now().UTC(),
+			UpdatedAt: time.Now().UTC(),
+			UserID:    user.ID,
+			Name:      entry.Name,
+			Url:       entry.URL,
+		})
+		if err != nil {
+			return "", fmt.Errorf("couldn't create feed: %w", err)
+		}
+		actions = append(actions, "created feed")
+	} else if err != nil {
+		return "", fmt.Errorf("couldn't get feed: %w", err)
+	}
+
+	followed := false
+	if following[feed.ID] {
+		actions = append(actions, "already following")
+	} else {
+		_, err = qtx.CreateFeedFollow(ctx, database.CreateFeedFollowParams{
+			ID:        uuid.New(),
+			CreatedAt: time.Now().UTC(),
+			UpdatedAt: time.Now().UTC(),
+			UserID:    user.ID,
+			FeedID:    feed.ID,
+		})
+		if err != nil {
+			return "", fmt.Errorf("couldn't create feed follow: %w", err)
+		}
+		_, err = hideMatchingPosts(ctx, qtx, user, uuid.NullUUID{UUID: feed.ID, Valid: true})
+		if err != nil {
+			return "", err
+		}
+		followed = true
+		actions = append(actions, "followed")
+	}
+
+	if entry.Category != "" {
+		err = qtx.SetFeedFollowCategory(ctx, database.SetFeedFollowCategoryParams{
+			UserID: user.ID,
+			FeedID: feed.ID,
+			Category: sql.NullString{
+				String: entry.Category,
+				Valid:  true,
+			},
+		})
+		if err != nil {
+			return "", fmt.Errorf("couldn't set category: %w", err)
+		}
+		actions = append(actions, "filed under "+entry.Category)
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return "", fmt.Errorf("couldn't commit transaction: %w", err)
+	}
+	if followed {
+		following[feed.ID] = true
+	}
+	return strings.Join(actions, ", "), nil
+}
+
+func handlerExport(s *state, cmd command, user database.User) error {
+	if len(cmd.Args) > 1 {
+		return fmt.Errorf("usage: %s [file]", cmd.Name)
+	}
+
+	feedFollows, err := s.db.GetFeedFollowsForUser(context.Background(), user.ID)
+	if err != nil {
+		return fmt.Errorf("couldn't get feed follows: %w", err)
+	}
+
+	opml := OPML{
+		Version: "2.0",
+		Head: OPMLHead{
+			Title:       fmt.Sprintf("gator subscriptions for %s", user.Name),
+			DateCreated: time.Now().UTC().Format(time.RFC1123Z),
+		},
+	}
+	for _, ff := range feedFollows {
+		var folders []string
+		if ff.Category.Valid && ff.Category.String != "" {
+			folders = strings.Split(ff.Category.String, "/")
+		}
+		opml.Body.Outline = addOutline(opml.Body.Outline, folders, OPMLOutline{
+			Text:   ff.FeedName,
+			Title:  ff.FeedName,
+			Type:   "rss",
+			XMLURL: ff.FeedUrl,
+		})
+	}
+
+	dat, err := xml.MarshalIndent(opml, "", "  ")
+	if err != nil {
+		return fmt.Errorf("couldn't encode OPML: %w", err)
+	}
+
+	var out io.Writer = os.Stdout
+	if len(cmd.Args) == 1 {
+		file, err := os.Create(cmd.Args[0])
+		if err != nil {
+			return fmt.Errorf("couldn't create export file: %w", err)
+		}
+		defer file.Close()
+		out = file
+	}
+
+	_, err = fmt.Fprintf(out, "%s%s\n", xml.Header, dat)
+	if err != nil {
+		return fmt.Errorf("couldn't write OPML: %w", err)
+	}
+
+	if len(cmd.Args) == 1 {
+		fmt.Printf("Exported %d feeds to %s\n", len(feedFollows), cmd.Args[0])
+	}
+	return nil
+}
+
+// addOutline appends feed to outlines inside the nested folders, creating
+// any folder outlines that don't exist yet.
+func addOutline(outlines []OPMLOutline, folders []string, feed OPMLOutline) []OPMLOutline {
+	if len(folders) == 0 {
+		return append(outlines, feed)
+	}
+	for i, outline := range outlines {
+		if outline.XMLURL == "" && outline.Text == folders[0] {
+			outlines[i].Outline = addOutline(outline.Outline, folders[1:], feed)
+			return outlines
+		}
+	}
+	return append(outlines, OPMLOutline{
+		Text:    folders[0],
+		Title:   folders[0],
+		Outline: addOutline(nil, folders[1:], feed),
+	})
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"encoding/xml"
+	"reflect"
+	"testing"
+)
+
+func TestFlattenOutlines(t *testing.T) {
+	const doc = `<opml version="2.0"><body>
+  <outline text="Tech">
+    <outline text="Go" xmlUrl=" https://go.dev/blog/feed.atom
+"/>
+    <outline text="Blank" xmlUrl="   "/>
+    <outline text="Nested">
+      <outline title="Deep" text="ignored" xmlUrl="https://deep.example.com/feed.xml"/>
+    </outline>
+  </outline>
+  <outline text="" xmlUrl="https://untitled.example.com/rss " category="/News/World,/Other"/>
+</body></opml>`
+
+	var opml OPML
+	err := xml.Unmarshal([]byte(doc), &opml)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := flattenOutlines(opml.Body.Outline, nil)
+	want := []opmlFeed{
+		{Name: "Go", URL: "https://go.dev/blog/feed.atom", Category: "Tech"},
+		{Name: "Deep", URL: "https://deep.example.com/feed.xml", Category: "Tech/Nested"},
+		{Name: "https://untitled.example.com/rss", URL: "https://untitled.example.com/rss", Category: "News/World"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("flattenOutlines =\n%+v\nwant\n%+v", got, want)
+	}
+}
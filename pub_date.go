@@ -0,0 +1,132 @@
+package main
+
+import (
+	"strings"
+	"time"
+)
+
+// pubDateLayouts are the date formats seen in real-world feeds, most common
+// first. Day names followed by a comma are stripped before parsing, so only
+// the ctime layouts include one.
+var pubDateLayouts = []string{
+	// RFC 822 / RFC 1123 and their many variants.
+	"2 Jan 2006 15:04:05 -0700",
+	"2 Jan 2006 15:04:05 MST",
+	"2 Jan 2006 15:04:05 -0700 (MST)",
+	"2 Jan 2006 15:04 -0700",
+	"2 Jan 2006 15:04 MST",
+	"2 Jan 06 15:04:05 -0700",
+	"2 Jan 06 15:04:05 MST",
+	"2 Jan 06 15:04 -0700",
+	"2 Jan 06 15:04 MST",
+	"2 January 2006 15:04:05 -0700",
+	"2 January 2006 15:04:05 MST",
+	"2 Jan 2006 15:04:05",
+	"2 Jan 2006",
+	// RFC 850.
+	"02-Jan-06 15:04:05 MST",
+	// ISO 8601 / RFC 3339.
+	time.RFC3339Nano,
+	"2006-01-02T15:04Z07:00",
+	"2006-01-02T15:04:05.999999999",
+	"2006-01-02T15:04",
+	"2006-01-02 15:04:05Z07:00",
+	"2006-01-02 15:04:05 -0700",
+	"2006-01-02 15:04:05 MST",
+	"2006-01-02 15:04:05",
+	"2006-01-02",
+	// ctime and friends.
+	"Mon Jan 2 15:04:05 2006",
+	"Mon Jan 2 15:04:05 MST 2006",
+}
+
+// zoneOffsets holds the zone abbreviations RFC 822 allows plus a few common
+// ones. time.Parse only knows the offset of abbreviations used by the local
+// zone and treats the rest as UTC.
+var zoneOffsets = map[string]int{
+	"UT":   0,
+	"UTC":  0,
+	"GMT":  0,
+	"Z":    0,
+	"EST":  -5 * 60 * 60,
+	"EDT":  -4 * 60 * 60,
+	"CST":  -6 * 60 * 60,
+	"CDT":  -5 * 60 * 60,
+	"MST":  -7 * 60 * 60,
+	"MDT":  -6 * 60 * 60,
+	"PST":  -8 * 60 * 60,
+	"PDT":  -7 * 60 * 60,
+	"CET":  1 * 60 * 60,
+	"CEST": 2 * 60 * 60,
+	"BST":  1 * 60 * 60,
+	"IST":  5*60*60 + 30*60,
+	"JST":  9 * 60 * 60,
+	"AEST": 10 * 60 * 60,
+	"AEDT": 11 * 60 * 60,
+}
+
+// parsePubDate parses a feed date in any of pubDateLayouts and normalizes
+// it to UTC.
+func parsePubDate(value string) (time.Time, bool) {
+	value = strings.Join(strings.Fields(value), " ")
+	if value == "" {
+		return time.Time{}, false
+	}
+
+	// Day names are redundant and frequently wrong or misspelled, so drop
+	// them ("Tue, 02 Jan 2024", "Tuesday, 02-Jan-24").
+	if i := strings.Index(value, ","); i > 0 && i < len("Wednesday,") && isLetters(value[:i]) {
+		value = strings.TrimSpace(value[i+1:])
+	}
+
+	// time.Parse won't take a zone abbreviation shorter than three letters,
+	// so spell out RFC 822's UT and Z.
+	if i := strings.LastIndex(value, " "); i > 0 {
+		switch strings.ToUpper(value[i+1:]) {
+		case "UT", "Z":
+			value = value[:i] + " UTC"
+		}
+	}
+
+	for _, layout := range pubDateLayouts {
+		t, err := time.Parse(layout, value)
+		if err != nil {
+			continue
+		}
+		name, offset := t.Zone()
+		if knownOffset, ok := zoneOffsets[strings.ToUpper(name)]; ok && offset != knownOffset {
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), time.FixedZone(name, knownOffset))
+		}
+		return t.UTC(), true
+	}
+	return time.Time{}, false
+}
+
+func isLetters(s string) bool {
+	for _, r := range s {
+		if (r < 'a' || r > 'z') && (r < 'A' || r > 'Z') {
+			return false
+		}
+	}
+	return true
+}
+
+// itemPublishedAt returns when an item was published, falling back to
+// fetchedAt so undated items still sort sensibly in browse.
+func itemPublishedAt(item RSSItem, fetchedAt time.Time) time.Time {
+	if t, ok := itemDate(item); ok {
+		return t
+	}
+	return fetchedAt.UTC()
+}
+
+// itemDate parses an item's pubDate, falling back to its updated and
+// dc:date fields.
+func itemDate(item RSSItem) (time.Time, bool) {
+	for _, value := range []string{item.PubDate, item.Updated, item.DCDate} {
+		if t, ok := parsePubDate(value); ok {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestParsePubDate(t *testing.T) {
+	tests := []struct {
+		layout string
+		value  string
+		want   string
+	}{
+		{"2 Jan 2006 15:04:05 -0700", "Tue, 02 Jan 2024 15:04:05 -0800", "2024-01-02T23:04:05Z"},
+		{"2 Jan 2006 15:04:05 MST", "Tue, 02 Jan 2024 15:04:05 GMT", "2024-01-02T15:04:05Z"},
+		{"2 Jan 2006 15:04:05 -0700 (MST)", "Tue, 2 Jan 2024 15:04:05 +0100 (CET)", "2024-01-02T14:04:05Z"},
+		{"2 Jan 2006 15:04 -0700", "02 Jan 2024 15:04 +0000", "2024-01-02T15:04:00Z"},
+		{"2 Jan 2006 15:04 MST", "Tue, 02 Jan 2024 15:04 EST", "2024-01-02T20:04:00Z"},
+		{"2 Jan 06 15:04:05 -0700", "Tue, 02 Jan 24 15:04:05 +0900", "2024-01-02T06:04:05Z"},
+		{"2 Jan 06 15:04:05 MST", "02 Jan 24 15:04:05 PDT", "2024-01-02T22:04:05Z"},
+		{"2 Jan 06 15:04 -0700", "02 Jan 24 15:04 -0500", "2024-01-02T20:04:00Z"},
+		{"2 Jan 06 15:04 MST", "02 Jan 24 15:04 UTC", "2024-01-02T15:04:00Z"},
+		{"2 January 2006 15:04:05 -0700", "Tuesday, 2 January 2024 15:04:05 +0200", "2024-01-02T13:04:05Z"},
+		{"2 January 2006 15:04:05 MST", "2 January 2024 15:04:05 BST", "2024-01-02T14:04:05Z"},
+		{"2 Jan 2006 15:04:05", "Tue, 02 Jan 2024 15:04:05", "2024-01-02T15:04:05Z"},
+		{"2 Jan 2006", "2 Jan 2024", "2024-01-02T00:00:00Z"},
+		{"02-Jan-06 15:04:05 MST", "Tuesday, 02-Jan-24 15:04:05 GMT", "2024-01-02T15:04:05Z"},
+		{time.RFC3339Nano, "2024-01-02T15:04:05.123+02:00", "2024-01-02T13:04:05.123Z"},
+		{"2006-01-02T15:04Z07:00", "2024-01-02T15:04Z", "2024-01-02T15:04:00Z"},
+		{"2006-01-02T15:04:05.999999999", "2024-01-02T15:04:05", "2024-01-02T15:04:05Z"},
+		{"2006-01-02T15:04", "2024-01-02T15:04", "2024-01-02T15:04:00Z"},
+		{"2006-01-02 15:04:05Z07:00", "2024-01-02 15:04:05-03:00", "2024-01-02T18:04:05Z"},
+		{"2006-01-02 15:04:05 -0700", "2024-01-02 15:04:05 +0530", "2024-01-02T09:34:05Z"},
+		{"2006-01-02 15:04:05 MST", "2024-01-02 15:04:05 JST", "2024-01-02T06:04:05Z"},
+		{"2006-01-02 15:04:05", "2024-01-02 15:04:05", "2024-01-02T15:04:05Z"},
+		{"2006-01-02", "2024-01-02", "2024-01-02T00:00:00Z"},
+		{"Mon Jan 2 15:04:05 2006", "Tue Jan  2 15:04:05 2024", "2024-01-02T15:04:05Z"},
+		{"Mon Jan 2 15:04:05 MST 2006", "Tue Jan 2 15:04:05 MST 2024", "2024-01-02T22:04:05Z"},
+	}
+
+	covered := make(map[string]bool)
+	for _, tt := range tests {
+		covered[tt.layout] = true
+		t.Run(tt.value, func(t *testing.T) {
+			got, ok := parsePubDate(tt.value)
+			if !ok {
+				t.Fatalf("parsePubDate(%q) failed", tt.value)
+			}
+			if got.Location() != time.UTC {
+				t.Errorf("parsePubDate(%q) is in %s, want UTC", tt.value, got.Location())
+			}
+			if got.Format(time.RFC3339Nano) != tt.want {
+				t.Errorf("parsePubDate(%q) = %s, want %s", tt.value, got.Format(time.RFC3339Nano), tt.want)
+			}
+		})
+	}
+	for _, layout := range pubDateLayouts {
+		if !covered[layout] {
+			t.Errorf("layout %q has no test case", layout)
+		}
+	}
+}
+
+func TestParsePubDateZones(t *testing.T) {
+	for zone, offset := range zoneOffsets {
+		for _, value := range []string{
+			"Tue, 02 Jan 2024 12:00:00 " + zone,
+			"2024-01-02 12:00:00 " + zone,
+		} {
+			got, ok := parsePubDate(value)
+			if !ok {
+				t.Errorf("parsePubDate(%q) failed", value)
+				continue
+			}
+			want := time.Date(2024, 1, 2, 12, 0, 0, 0, time.UTC).Add(-time.Duration(offset) * time.Second)
+			if !got.Equal(want) {
+				t.Errorf("parsePubDate(%q) = %s, want %s", value, got, want)
+			}
+		}
+	}
+}
+
+func TestParsePubDateInvalid(t *testing.T) {
+	for _, value := range []string{
+		"",
+		"   ",
+		"yesterday",
+		"2024-13-45",
+		"Tue, 32 Jan 2024 15:04:05 GMT",
+		fmt.Sprint(time.Now().Unix()),
+	} {
+		if got, ok := parsePubDate(value); ok {
+			t.Errorf("parsePubDate(%q) = %s, want failure", value, got)
+		}
+	}
+}
+
+func TestItemPublishedAtFallbacks(t *testing.T) {
+	fetchedAt := time.Date(2024, 6, 1, 8, 0, 0, 0, time.FixedZone("", 2*60*60))
+
+	tests := []struct {
+		name string
+		item RSSItem
+		want time.Time
+	}{
+		{"pubDate", RSSItem{PubDate: "Tue, 02 Jan 2024 15:04:05 GMT", Updated: "2024-02-01T00:00:00Z"}, time.Date(2024, 1, 2, 15, 4, 5, 0, time.UTC)},
+		{"bad pubDate uses updated", RSSItem{PubDate: "soon", Updated: "2024-02-01T00:00:00Z"}, time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)},
+		{"dc:date", RSSItem{DCDate: "2024-03-01T00:00:00+01:00"}, time.Date(2024, 2, 29, 23, 0, 0, 0, time.UTC)},
+		{"undated", RSSItem{}, fetchedAt.UTC()},
+	}
+	for _, tt := range tests {
+		if got := itemPublishedAt(tt.item, fetchedAt); !got.Equal(tt.want) || got.Location() != time.UTC {
+			t.Errorf("%s: itemPublishedAt = %s, want %s", tt.name, got, tt.want)
+		}
+	}
+}
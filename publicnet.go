@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"syscall"
+	"time"
+)
+
+// errPrivateAddress is returned when a request made for a remote caller
+// would reach a loopback, link-local or private address.
+var errPrivateAddress = errors.New("address is not publicly routable")
+
+// feedHTTPClient fetches feeds and pages for the CLI and agg, where the
+// person running gator picked the URLs and may well mean a local server.
+var feedHTTPClient = &http.Client{
+	Timeout: 10 * time.Second,
+}
+
+// publicHTTPClient fetches URLs that callers of the API and web interface
+// supply. It refuses to connect to anything but public addresses, checked
+// on every connection so redirects and DNS answers can't get around it.
+var publicHTTPClient = &http.Client{
+	Timeout:   10 * time.Second,
+	Transport: newPublicTransport(),
+}
+
+func newPublicTransport() *http.Transport {
+	dialer := &net.Dialer{
+		Timeout:   10 * time.Second,
+		KeepAlive: 30 * time.Second,
+		Control:   publicDialControl,
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	// A proxy would be the only address dialed, hiding the real target.
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+	return transport
+}
+
+// publicDialControl rejects connections to non-public addresses. address
+// has already been resolved, so it's always an IP and port.
+func publicDialControl(network, address string, c syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip, err := netip.ParseAddr(host)
+	if err != nil {
+		return err
+	}
+	if !isPublicAddr(ip) {
+		return fmt.Errorf("%w: %s", errPrivateAddress, ip)
+	}
+	return nil
+}
+
+// checkPublicHost resolves host and returns errPrivateAddress if any of its
+// addresses isn't public. It's for rejecting URLs up front; connections
+// still have to go through a client that checks what it dials, since DNS
+// answers can change.
+func checkPublicHost(ctx context.Context, host string) error {
+	var addrs []netip.Addr
+	if ip, err := netip.ParseAddr(host); err == nil {
+		addrs = []netip.Addr{ip}
+	} else {
+		addrs, err = net.DefaultResolver.LookupNetIP(ctx, "ip", host)
+		if err != nil {
+			return fmt.Errorf("couldn't resolve %s: %w", host, err)
+		}
+	}
+	for _, ip := range addrs {
+		if !isPublicAddr(ip) {
+			return fmt.Errorf("%w: %s resolves to %s", errPrivateAddress, host, ip)
+		}
+	}
+	return nil
+}
+
+// nonPublicPrefixes are ranges that netip doesn't classify but that aren't
+// reachable on the internet either.
+var nonPublicPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),
+	netip.MustParsePrefix("100.64.0.0/10"),
+	netip.MustParsePrefix("192.0.0.0/24"),
+	netip.MustParsePrefix("198.18.0.0/15"),
+	netip.MustParsePrefix("240.0.0.0/4"),
+	netip.MustParsePrefix("64:ff9b:1::/48"),
+	netip.MustParsePrefix("2001:db8::/32"),
+}
+
+// isPublicAddr reports whether ip is a unicast address outside the
+// loopback, link-local, private and other reserved ranges.
+func isPublicAddr(ip netip.Addr) bool {
+	ip = ip.Unmap()
+	if !ip.IsGlobalUnicast() || ip.IsPrivate() {
+		return false
+	}
+	for _, prefix := range nonPublicPrefixes {
+		if prefix.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
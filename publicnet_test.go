@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+)
+
+func TestIsPublicAddr(t *testing.T) {
+	tests := []struct {
+		addr string
+		want bool
+	}{
+		{"93.184.216.34", true},
+		{"2606:2800:220:1:248:1893:25c8:1946", true},
+		{"127.0.0.1", false},
+		{"::1", false},
+		{"10.1.2.3", false},
+		{"172.16.0.1", false},
+		{"192.168.1.1", false},
+		{"169.254.169.254", false},
+		{"fe80::1", false},
+		{"fd00::1", false},
+		{"100.64.0.1", false},
+		{"0.0.0.0", false},
+		{"::", false},
+		{"224.0.0.1", false},
+		{"255.255.255.255", false},
+		{"::ffff:127.0.0.1", false},
+		{"::ffff:192.168.1.1", false},
+		{"::ffff:93.184.216.34", true},
+	}
+	for _, tt := range tests {
+		if got := isPublicAddr(netip.MustParseAddr(tt.addr)); got != tt.want {
+			t.Errorf("isPublicAddr(%s) = %t, want %t", tt.addr, got, tt.want)
+		}
+	}
+}
+
+func TestPublicHTTPClientRefusesLocalServers(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/rss+xml")
+		fmt.Fprint(w, `<rss version="2.0"><channel><title>Internal</title></channel></rss>`)
+	}))
+	defer server.Close()
+
+	// The CLI may fetch local feeds...
+	candidates, err := discoverFeeds(context.Background(), feedHTTPClient, server.URL)
+	if err != nil || len(candidates) != 1 {
+		t.Fatalf("discoverFeeds with feedHTTPClient = %v, %v; want the local feed", candidates, err)
+	}
+
+	// ...but a URL from an API or web caller may not reach them.
+	_, err = discoverFeeds(context.Background(), publicHTTPClient, server.URL)
+	if !errors.Is(err, errPrivateAddress) {
+		t.Errorf("discoverFeeds with publicHTTPClient: err = %v, want %v", err, errPrivateAddress)
+	}
+}
+
+func TestScrapeFeedPublicOnly(t *testing.T) {
+	db, queries := testDB(t)
+	ctx := context.Background()
+	user := createTestUser(t, queries, "alice")
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/rss+xml")
+		fmt.Fprint(w, `<rss version="2.0"><channel><title>Internal</title></channel></rss>`)
+	}))
+	defer server.Close()
+
+	// A feed added from the CLI may be local...
+	local, _, err := addFeed(ctx, queries, user, "Local", server.URL+"/cli.xml", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result := scrapeFeed(ctx, db, queries, local, 10); result.Err != nil {
+		t.Errorf("scrapeFeed of a CLI feed: %v", result.Err)
+	}
+
+	// ...but one added over HTTP can't reach local servers, however its
+	// URL resolves by the time it's fetched.
+	remote, _, err := addFeed(ctx, queries, user, "Remote", server.URL+"/api.xml", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result := scrapeFeed(ctx, db, queries, remote, 10); !errors.Is(result.Err, errPrivateAddress) {
+		t.Errorf("scrapeFeed of an API feed: err = %v, want %v", result.Err, errPrivateAddress)
+	}
+}
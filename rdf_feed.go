@@ -0,0 +1,64 @@
+package main
+
+import (
+	"encoding/xml"
+	"strings"
+)
+
+const (
+	rdfNamespace   = "http://www.w3.org/1999/02/22-rdf-syntax-ns#"
+	rss10Namespace = "http://purl.org/rss/1.0/"
+	dcNamespace    = "http://purl.org/dc/elements/1.1/"
+)
+
+// RDFFeed is an RSS 1.0 document. Unlike RSS 2.0, items are siblings of the
+// channel rather than children of it.
+type RDFFeed struct {
+	XMLName xml.Name `xml:"http://www.w3.org/1999/02/22-rdf-syntax-ns# RDF"`
+	Channel struct {
+		Title       string `xml:"http://purl.org/rss/1.0/ title"`
+		Link        string `xml:"http://purl.org/rss/1.0/ link"`
+		Description string `xml:"http://purl.org/rss/1.0/ description"`
+	} `xml:"http://purl.org/rss/1.0/ channel"`
+	Item []RDFItem `xml:"http://purl.org/rss/1.0/ item"`
+}
+
+type RDFItem struct {
+	About       string `xml:"http://www.w3.org/1999/02/22-rdf-syntax-ns# about,attr"`
+	Title       string `xml:"http://purl.org/rss/1.0/ title"`
+	Link        string `xml:"http://purl.org/rss/1.0/ link"`
+	Description string `xml:"http://purl.org/rss/1.0/ description"`
+	Date        string `xml:"http://purl.org/dc/elements/1.1/ date"`
+	Creator     string `xml:"http://purl.org/dc/elements/1.1/ creator"`
+}
+
+type rdfFeedFormat struct{}
+
+func (rdfFeedFormat) matches(root xml.Name, dat []byte) bool {
+	return root.Space == rdfNamespace && root.Local == "RDF"
+}
+
+func (rdfFeedFormat) parse(dat []byte) (*RSSFeed, error) {
+	var rdfFeed RDFFeed
+	err := xml.Unmarshal(dat, &rdfFeed)
+	if err != nil {
+		return nil, err
+	}
+
+	rssFeed := &RSSFeed{}
+	rssFeed.Channel.Title = strings.TrimSpace(rdfFeed.Channel.Title)
+	rssFeed.Channel.Link = strings.TrimSpace(rdfFeed.Channel.Link)
+	rssFeed.Channel.Description = strings.TrimSpace(rdfFeed.Channel.Description)
+	for _, item := range rdfFeed.Item {
+		rssFeed.Channel.Item = append(rssFeed.Channel.Item, RSSItem{
+			Title:       strings.TrimSpace(item.Title),
+			Link:        strings.TrimSpace(item.Link),
+			Description: strings.TrimSpace(item.Description),
+			GUID:        item.About,
+			DCDate:      item.Date,
+			DCCreator:   strings.TrimSpace(item.Creator),
+		})
+	}
+
+	return rssFeed, nil
+}
@@ -0,0 +1,681 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/VuTLy/blogAggregator/internal/database"
+	"github.com/google/uuid"
+)
+
+// The Google Reader API, as implemented by FreshRSS and Inoreader and spoken
+// by mobile readers such as Reeder and NetNewsWire. Clients log in with the
+// user name and an API key as the password, and the key doubles as the auth
+// token. Streams are named after what they contain:
+//
+//	user/-/state/com.google/reading-list   every followed feed
+//	user/-/state/com.google/starred        starred posts
+//	user/-/state/com.google/read           read posts
+//	user/-/label/<category>                feeds filed under a category
+//	feed/<url>                             one feed
+const (
+	readerStreamReadingList = "user/-/state/com.google/reading-list"
+	readerStreamStarred     = "user/-/state/com.google/starred"
+	readerStreamRead        = "user/-/state/com.google/read"
+	readerStreamKeptUnread  = "user/-/state/com.google/kept-unread"
+	readerLabelPrefix       = "user/-/label/"
+	readerFeedPrefix        = "feed/"
+	readerItemPrefix        = "tag:google.com,2005:reader/item/"
+
+	maxReaderItems = 10000
+)
+
+var readerUserPattern = regexp.MustCompile(`^user/[^/]+/`)
+
+func registerReaderRoutes(handle func(pattern string, handler apiHandler)) {
+	handle("/accounts/ClientLogin", readerClientLogin)
+	handle("GET /reader/api/0/token", readerMiddlewareAuth(readerToken))
+	handle("GET /reader/api/0/user-info", readerMiddlewareAuth(readerUserInfo))
+	handle("GET /reader/api/0/subscription/list", readerMiddlewareAuth(readerSubscriptionList))
+	handle("GET /reader/api/0/tag/list", readerMiddlewareAuth(readerTagList))
+	handle("GET /reader/api/0/unread-count", readerMiddlewareAuth(readerUnreadCount))
+	handle("GET /reader/api/0/stream/items/ids", readerMiddlewareAuth(readerStreamItemIDs))
+	handle("/reader/api/0/stream/items/contents", readerMiddlewareAuth(readerStreamItemContents))
+	handle("GET /reader/api/0/stream/contents/{stream...}", readerMiddlewareAuth(readerStreamContents))
+	handle("POST /reader/api/0/edit-tag", readerMiddlewareAuth(readerEditTag))
+	handle("POST /reader/api/0/mark-all-as-read", readerMiddlewareAuth(readerMarkAllAsRead))
+}
+
+// readerMiddlewareAuth is the Google Reader API's middlewareLoggedIn: it
+// resolves the user from an "Authorization: GoogleLogin auth=<key>" header.
+func readerMiddlewareAuth(handler func(s *state, w http.ResponseWriter, r *http.Request, user database.User)) apiHandler {
+	return func(s *state, w http.ResponseWriter, r *http.Request) {
+		scheme, token, _ := strings.Cut(r.Header.Get("Authorization"), " ")
+		key, ok := strings.CutPrefix(strings.TrimSpace(token), "auth=")
+		if !strings.EqualFold(scheme, "GoogleLogin") || !ok || key == "" {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		user, err := s.db.GetUserByAPIKey(r.Context(), hashAPIKey(key))
+		if errors.Is(err, sql.ErrNoRows) {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if err != nil {
+			readerError(w, "couldn't get user", err)
+			return
+		}
+
+		handler(s, w, r, user)
+	}
+}
+
+func readerClientLogin(s *state, w http.ResponseWriter, r *http.Request) {
+	name := r.FormValue("Email")
+	key := r.FormValue("Passwd")
+
+	user, err := s.db.GetUserByAPIKey(r.Context(), hashAPIKey(key))
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && !strings.EqualFold(user.Name, name)) {
+		http.Error(w, "Error=BadAuthentication", http.StatusUnauthorized)
+		return
+	}
+	if err != nil {
+		readerError(w, "couldn't get user", err)
+		return
+	}
+
+	if r.FormValue("output") == "json" {
+		respondWithJSON(w, http.StatusOK, map[string]string{
+			"SID":  key,
+			"LSID": key,
+			"Auth": key,
+		})
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	fmt.Fprintf(w, "SID=%s\nLSID=%s\nAuth=%s\n", key, key, key)
+}
+
+// readerToken hands out the token clients send back as T with edits. Every
+// request already carries the API key, so it's never checked.
+func readerToken(s *state, w http.ResponseWriter, r *http.Request, user database.User) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	fmt.Fprintln(w, strings.ReplaceAll(user.ID.String(), "-", ""))
+}
+
+func readerUserInfo(s *state, w http.ResponseWriter, r *http.Request, user database.User) {
+	respondWithJSON(w, http.StatusOK, map[string]string{
+		"userId":        user.ID.String(),
+		"userName":      user.Name,
+		"userProfileId": user.ID.String(),
+		"userEmail":     "",
+	})
+}
+
+type readerCategory struct {
+	ID    string `json:"id"`
+	Label string `json:"label"`
+}
+
+type readerSubscription struct {
+	ID         string           `json:"id"`
+	Title      string           `json:"title"`
+	Categories []readerCategory `json:"categories"`
+	URL        string           `json:"url"`
+	HTMLURL    string           `json:"htmlUrl"`
+	IconURL    string           `json:"iconUrl"`
+}
+
+func readerSubscriptionList(s *state, w http.ResponseWriter, r *http.Request, user database.User) {
+	feedFollows, err := s.db.GetFeedFollowsForUser(r.Context(), user.ID)
+	if err != nil {
+		readerError(w, "couldn't get feed follows", err)
+		return
+	}
+
+	subscriptions := make([]readerSubscription, 0, len(feedFollows))
+	for _, ff := range feedFollows {
+		subscription := readerSubscription{
+			ID:         readerFeedPrefix + ff.FeedUrl,
+			Title:      ff.FeedName,
+			Categories: []readerCategory{},
+			URL:        ff.FeedUrl,
+			HTMLURL:    ff.FeedUrl,
+		}
+		if ff.Category.Valid && ff.Category.String != "" {
+			subscription.Categories = append(subscription.Categories, readerCategory{
+				ID:    readerLabelPrefix + ff.Category.String,
+				Label: ff.Category.String,
+			})
+		}
+		subscriptions = append(subscriptions, subscription)
+	}
+
+	respondWithJSON(w, http.StatusOK, map[string]any{
+		"subscriptions": subscriptions,
+	})
+}
+
+func readerTagList(s *state, w http.ResponseWriter, r *http.Request, user database.User) {
+	feedFollows, err := s.db.GetFeedFollowsForUser(r.Context(), user.ID)
+	if err != nil {
+		readerError(w, "couldn't get feed follows", err)
+		return
+	}
+
+	type tag struct {
+		ID   string `json:"id"`
+		Type string `json:"type,omitempty"`
+	}
+	tags := []tag{{ID: readerStreamStarred}}
+	seen := map[string]bool{}
+	for _, ff := range feedFollows {
+		if ff.Category.Valid && ff.Category.String != "" && !seen[ff.Category.String] {
+			seen[ff.Category.String] = true
+			tags = append(tags, tag{
+				ID:   readerLabelPrefix + ff.Category.String,
+				Type: "folder",
+			})
+		}
+	}
+
+	respondWithJSON(w, http.StatusOK, map[string]any{
+		"tags": tags,
+	})
+}
+
+func readerUnreadCount(s *state, w http.ResponseWriter, r *http.Request, user database.User) {
+	feedFollows, err := s.db.GetFeedFollowsForUser(r.Context(), user.ID)
+	if err != nil {
+		readerError(w, "couldn't get feed follows", err)
+		return
+	}
+	unreadCounts, err := s.db.GetUnreadCountsForUser(r.Context(), user.ID)
+	if err != nil {
+		readerError(w, "couldn't get unread counts", err)
+		return
+	}
+	unread := map[uuid.UUID]int64{}
+	for _, row := range unreadCounts {
+		unread[row.FeedID] = row.UnreadCount
+	}
+
+	type count struct {
+		ID    string `json:"id"`
+		Count int64  `json:"count"`
+	}
+	var total int64
+	labels := map[string]int64{}
+	counts := []count{}
+	for _, ff := range feedFollows {
+		n := unread[ff.FeedID]
+		total += n
+		if ff.Category.Valid && ff.Category.String != "" {
+			labels[ff.Category.String] += n
+		}
+		counts = append(counts, count{ID: readerFeedPrefix + ff.FeedUrl, Count: n})
+	}
+	for label, n := range labels {
+		counts = append(counts, count{ID: readerLabelPrefix + label, Count: n})
+	}
+	counts = append(counts, count{ID: readerStreamReadingList, Count: total})
+
+	respondWithJSON(w, http.StatusOK, map[string]any{
+		"max":          total,
+		"unreadcounts": counts,
+	})
+}
+
+type readerItemRef struct {
+	ID            string `json:"id"`
+	TimestampUsec string `json:"timestampUsec"`
+}
+
+func readerStreamItemIDs(s *state, w http.ResponseWriter, r *http.Request, user database.User) {
+	rows, continuation, ok := queryReaderStream(s, w, r, user, r.FormValue("s"))
+	if !ok {
+		return
+	}
+
+	refs := make([]readerItemRef, 0, len(rows))
+	for _, row := range rows {
+		refs = append(refs, readerItemRef{
+			ID:            strconv.FormatInt(row.ItemID, 10),
+			TimestampUsec: strconv.FormatInt(row.PublishedAt.Time.UnixMicro(), 10),
+		})
+	}
+
+	response := map[string]any{
+		"itemRefs": refs,
+	}
+	if continuation != "" {
+		response["continuation"] = continuation
+	}
+	respondWithJSON(w, http.StatusOK, response)
+}
+
+func readerStreamItemContents(s *state, w http.ResponseWriter, r *http.Request, user database.User) {
+	err := r.ParseForm()
+	if err != nil {
+		http.Error(w, "invalid form", http.StatusBadRequest)
+		return
+	}
+
+	var itemIDs []int64
+	for _, value := range r.Form["i"] {
+		itemID, err := parseReaderItemID(value)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		itemIDs = append(itemIDs, itemID)
+	}
+
+	items, err := s.db.GetReaderItems(r.Context(), database.GetReaderItemsParams{
+		UserID:  user.ID,
+		ItemIds: itemIDs,
+	})
+	if err != nil {
+		readerError(w, "couldn't get items", err)
+		return
+	}
+
+	respondWithReaderItems(w, readerStreamReadingList, "", items)
+}
+
+// readerStreamContents is stream/items/ids and stream/items/contents in one
+// request, which some clients use instead.
+func readerStreamContents(s *state, w http.ResponseWriter, r *http.Request, user database.User) {
+	stream := r.PathValue("stream")
+	rows, continuation, ok := queryReaderStream(s, w, r, user, stream)
+	if !ok {
+		return
+	}
+
+	itemIDs := make([]int64, 0, len(rows))
+	for _, row := range rows {
+		itemIDs = append(itemIDs, row.ItemID)
+	}
+	items, err := s.db.GetReaderItems(r.Context(), database.GetReaderItemsParams{
+		UserID:  user.ID,
+		ItemIds: itemIDs,
+	})
+	if err != nil {
+		readerError(w, "couldn't get items", err)
+		return
+	}
+
+	// Keep the order the stream was asked for.
+	byID := map[int64]database.GetReaderItemsRow{}
+	for _, item := range items {
+		byID[item.ItemID] = item
+	}
+	ordered := make([]database.GetReaderItemsRow, 0, len(items))
+	for _, itemID := range itemIDs {
+		if item, ok := byID[itemID]; ok {
+			ordered = append(ordered, item)
+		}
+	}
+
+	respondWithReaderItems(w, stream, continuation, ordered)
+}
+
+// queryReaderStream lists the item IDs in a stream using the standard
+// paging and filtering parameters: n (count), c (continuation), r=o (oldest
+// first), xt and it (exclude or include only a state), and ot and nt (oldest
+// and newest time in seconds). It responds with an error itself and returns
+// false if the request is invalid.
+func queryReaderStream(s *state, w http.ResponseWriter, r *http.Request, user database.User, stream string) ([]database.GetReaderItemIDsRow, string, bool) {
+	params := database.GetReaderItemIDsParams{
+		UserID:      user.ID,
+		OldestFirst: r.FormValue("r") == "o",
+		MaxItems:    20,
+	}
+
+	err := applyReaderStream(s, r, &params, stream)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return nil, "", false
+	}
+	for _, state := range r.Form["xt"] {
+		if normalizeReaderStream(state) == readerStreamRead {
+			params.ExcludeRead = true
+		}
+	}
+	for _, state := range r.Form["it"] {
+		if normalizeReaderStream(state) == readerStreamStarred {
+			params.StarredOnly = true
+		}
+	}
+
+	if value := r.FormValue("n"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 {
+			http.Error(w, "invalid n", http.StatusBadRequest)
+			return nil, "", false
+		}
+		params.MaxItems = int32(min(n, maxReaderItems))
+	}
+	if value := r.FormValue("c"); value != "" {
+		offset, err := strconv.Atoi(value)
+		if err != nil || offset < 0 {
+			http.Error(w, "invalid continuation", http.StatusBadRequest)
+			return nil, "", false
+		}
+		params.SkipItems = int32(offset)
+	}
+	for name, target := range map[string]*sql.NullTime{"ot": &params.Since, "nt": &params.Until} {
+		value := r.FormValue(name)
+		if value == "" {
+			continue
+		}
+		seconds, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			http.Error(w, "invalid "+name, http.StatusBadRequest)
+			return nil, "", false
+		}
+		*target = sql.NullTime{
+			Time:  time.Unix(seconds, 0).UTC(),
+			Valid: true,
+		}
+	}
+
+	rows, err := s.db.GetReaderItemIDs(r.Context(), params)
+	if err != nil {
+		readerError(w, "couldn't get item IDs", err)
+		return nil, "", false
+	}
+
+	continuation := ""
+	if int32(len(rows)) == params.MaxItems {
+		continuation = strconv.Itoa(int(params.SkipItems + params.MaxItems))
+	}
+	return rows, continuation, true
+}
+
+// applyReaderStream narrows params to the posts in stream.
+func applyReaderStream(s *state, r *http.Request, params *database.GetReaderItemIDsParams, stream string) error {
+	stream = normalizeReaderStream(stream)
+	switch {
+	case stream == "" || stream == readerStreamReadingList:
+	case stream == readerStreamStarred:
+		params.StarredOnly = true
+	case stream == readerStreamRead:
+		params.ReadOnly = true
+	case strings.HasPrefix(stream, readerLabelPrefix):
+		params.Category = sql.NullString{
+			String: strings.TrimPrefix(stream, readerLabelPrefix),
+			Valid:  true,
+		}
+	case strings.HasPrefix(stream, readerFeedPrefix):
+		feed, err := s.db.GetFeedByURL(r.Context(), strings.TrimPrefix(stream, readerFeedPrefix))
+		if err != nil {
+			return fmt.Errorf("unknown feed %s", stream)
+		}
+		params.FeedID = uuid.NullUUID{
+			UUID:  feed.ID,
+			Valid: true,
+		}
+	default:
+		return fmt.Errorf("unsupported stream %s", stream)
+	}
+	return nil
+}
+
+// normalizeReaderStream replaces the user ID clients may put in a stream
+// name with "-", which always means the current user.
+func normalizeReaderStream(stream string) string {
+	return readerUserPattern.ReplaceAllString(stream, "user/-/")
+}
+
+// parseReaderItemID accepts an item ID in any of the forms clients send: the
+// long "tag:google.com,2005:reader/item/<hex>" form, or a bare decimal.
+func parseReaderItemID(value string) (int64, error) {
+	if hexID, ok := strings.CutPrefix(value, readerItemPrefix); ok {
+		itemID, err := strconv.ParseUint(hexID, 16, 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid item ID %s", value)
+		}
+		return int64(itemID), nil
+	}
+	itemID, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid item ID %s", value)
+	}
+	return itemID, nil
+}
+
+type readerLink struct {
+	Href string `json:"href"`
+	Type string `json:"type,omitempty"`
+}
+
+type readerItem struct {
+	ID            string       `json:"id"`
+	CrawlTimeMsec string       `json:"crawlTimeMsec"`
+	TimestampUsec string       `json:"timestampUsec"`
+	Published     int64        `json:"published"`
+	Updated       int64        `json:"updated"`
+	Title         string       `json:"title"`
+	Canonical     []readerLink `json:"canonical"`
+	Alternate     []readerLink `json:"alternate"`
+	Summary       struct {
+		Content string `json:"content"`
+	} `json:"summary"`
+	Categories []string `json:"categories"`
+	Origin     struct {
+		StreamID string `json:"streamId"`
+		Title    string `json:"title"`
+		HTMLURL  string `json:"htmlUrl"`
+	} `json:"origin"`
+}
+
+func respondWithReaderItems(w http.ResponseWriter, stream, continuation string, rows []database.GetReaderItemsRow) {
+	items := make([]readerItem, 0, len(rows))
+	for _, row := range rows {
+		published := row.CreatedAt
+		if row.PublishedAt.Valid {
+			published = row.PublishedAt.Time
+		}
+
+		item := readerItem{
+			ID:            fmt.Sprintf("%s%016x", readerItemPrefix, uint64(row.ItemID)),
+			CrawlTimeMsec: strconv.FormatInt(row.CreatedAt.UnixMilli(), 10),
+			TimestampUsec: strconv.FormatInt(published.UnixMicro(), 10),
+			Published:     published.Unix(),
+			Updated:       row.UpdatedAt.Unix(),
+			Title:         row.Title,
+			Canonical:     []readerLink{{Href: row.Url}},
+			Alternate:     []readerLink{{Href: row.Url, Type: "text/html"}},
+			Categories:    []string{readerStreamReadingList},
+		}
+		item.Summary.Content = row.Description.String
+		item.Origin.StreamID = readerFeedPrefix + row.FeedUrl
+		item.Origin.Title = row.FeedName
+		item.Origin.HTMLURL = row.FeedUrl
+		if row.Read {
+			item.Categories = append(item.Categories, readerStreamRead)
+		}
+		if row.Starred {
+			item.Categories = append(item.Categories, readerStreamStarred)
+		}
+		if row.Category.Valid && row.Category.String != "" {
+			item.Categories = append(item.Categories, readerLabelPrefix+row.Category.String)
+		}
+		items = append(items, item)
+	}
+
+	response := map[string]any{
+		"id":      stream,
+		"updated": time.Now().Unix(),
+		"items":   items,
+	}
+	if continuation != "" {
+		response["continuation"] = continuation
+	}
+	respondWithJSON(w, http.StatusOK, response)
+}
+
+// readerEditTag adds (a) and removes (r) the read and starred states on the
+// items listed as i. Items from feeds the user doesn't follow are skipped,
+// as GetReaderItems only finds posts in followed feeds.
+func readerEditTag(s *state, w http.ResponseWriter, r *http.Request, user database.User) {
+	err := r.ParseForm()
+	if err != nil {
+		http.Error(w, "invalid form", http.StatusBadRequest)
+		return
+	}
+
+	var itemIDs []int64
+	for _, value := range r.Form["i"] {
+		itemID, err := parseReaderItemID(value)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		itemIDs = append(itemIDs, itemID)
+	}
+	items, err := s.db.GetReaderItems(r.Context(), database.GetReaderItemsParams{
+		UserID:  user.ID,
+		ItemIds: itemIDs,
+	})
+	if err != nil {
+		readerError(w, "couldn't get items", err)
+		return
+	}
+
+	for _, item := range items {
+		for _, tag := range r.Form["a"] {
+			err = setReaderTag(s, r, user, item.ID, normalizeReaderStream(tag), true)
+			if err != nil {
+				readerError(w, "couldn't tag item", err)
+				return
+			}
+		}
+		for _, tag := range r.Form["r"] {
+			err = setReaderTag(s, r, user, item.ID, normalizeReaderStream(tag), false)
+			if err != nil {
+				readerError(w, "couldn't untag item", err)
+				return
+			}
+		}
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	fmt.Fprint(w, "OK")
+}
+
+// setReaderTag adds or removes one state tag on a post. Labels belong to
+// feeds rather than posts, so they're ignored.
+func setReaderTag(s *state, r *http.Request, user database.User, postID uuid.UUID, tag string, add bool) error {
+	if tag == readerStreamKeptUnread {
+		tag, add = readerStreamRead, !add
+	}
+
+	switch {
+	case tag == readerStreamRead && add:
+		_, err := s.db.MarkPostRead(r.Context(), database.MarkPostReadParams{
+			UserID: user.ID,
+			PostID: postID,
+		})
+		return err
+	case tag == readerStreamRead:
+		_, err := s.db.MarkPostUnread(r.Context(), database.MarkPostUnreadParams{
+			UserID: user.ID,
+			PostID: postID,
+		})
+		return err
+	case tag == readerStreamStarred && add:
+		return s.db.StarPost(r.Context(), database.StarPostParams{
+			UserID:    user.ID,
+			PostID:    postID,
+			CreatedAt: time.Now().UTC(),
+		})
+	case tag == readerStreamStarred:
+		_, err := s.db.UnstarPost(r.Context(), database.UnstarPostParams{
+			UserID: user.ID,
+			PostID: postID,
+		})
+		return err
+	}
+	return nil
+}
+
+// readerMarkAllAsRead marks every post in a followed feed, a label or the
+// whole reading list read. Clients send the time they last synced as ts, in
+// microseconds, and posts collected after it are left unread since the user
+// hasn't seen them yet.
+func readerMarkAllAsRead(s *state, w http.ResponseWriter, r *http.Request, user database.User) {
+	stream := normalizeReaderStream(r.FormValue("s"))
+
+	var createdBefore sql.NullTime
+	if ts := r.FormValue("ts"); ts != "" {
+		usec, err := strconv.ParseInt(ts, 10, 64)
+		if err != nil {
+			http.Error(w, "invalid ts", http.StatusBadRequest)
+			return
+		}
+		createdBefore = sql.NullTime{Time: time.UnixMicro(usec).UTC(), Valid: true}
+	}
+
+	var err error
+	switch {
+	case stream == readerStreamReadingList:
+		_, err = s.db.MarkAllPostsRead(r.Context(), database.MarkAllPostsReadParams{
+			UserID:        user.ID,
+			CreatedBefore: createdBefore,
+		})
+	case strings.HasPrefix(stream, readerFeedPrefix):
+		var feed database.Feed
+		feed, err = s.db.GetFeedByURL(r.Context(), strings.TrimPrefix(stream, readerFeedPrefix))
+		if err == nil {
+			_, err = s.db.MarkFeedPostsRead(r.Context(), database.MarkFeedPostsReadParams{
+				UserID:        user.ID,
+				FeedID:        feed.ID,
+				CreatedBefore: createdBefore,
+			})
+		}
+	case strings.HasPrefix(stream, readerLabelPrefix):
+		var feedFollows []database.GetFeedFollowsForUserRow
+		feedFollows, err = s.db.GetFeedFollowsForUser(r.Context(), user.ID)
+		for _, ff := range feedFollows {
+			if err != nil {
+				break
+			}
+			if ff.Category.String == strings.TrimPrefix(stream, readerLabelPrefix) {
+				_, err = s.db.MarkFeedPostsRead(r.Context(), database.MarkFeedPostsReadParams{
+					UserID:        user.ID,
+					FeedID:        ff.FeedID,
+					CreatedBefore: createdBefore,
+				})
+			}
+		}
+	default:
+		http.Error(w, "unsupported stream "+stream, http.StatusBadRequest)
+		return
+	}
+	if errors.Is(err, sql.ErrNoRows) {
+		http.Error(w, "unknown feed "+stream, http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		readerError(w, "couldn't mark posts read", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	fmt.Fprint(w, "OK")
+}
+
+func readerError(w http.ResponseWriter, msg string, err error) {
+	log.Printf("%s: %v", msg, err)
+	http.Error(w, msg, http.StatusInternalServerError)
+}
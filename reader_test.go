@@ -0,0 +1,253 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"text/template"
+	"time"
+
+	"github.com/VuTLy/blogAggregator/internal/config"
+	"github.com/VuTLy/blogAggregator/internal/database"
+	"github.com/google/uuid"
+)
+
+// readerExchange is one recorded request to the Google Reader API and the
+// response expected to it.
+type readerExchange struct {
+	method, target string
+	header         http.Header
+	body           string
+
+	status     int
+	wantHeader http.Header
+	wantBody   string
+}
+
+// readReaderExchange parses a fixture from testdata/reader after filling in
+// its template fields. A fixture is a request line ("METHOD target"),
+// headers, a blank line and a body, then a "--- response" line, the status
+// code, the headers to check, a blank line and the expected body.
+func readReaderExchange(t *testing.T, path string, data any) readerExchange {
+	t.Helper()
+	tmpl, err := template.ParseFiles(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	err = tmpl.Execute(&buf, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	request, response, ok := strings.Cut(buf.String(), "\n--- response\n")
+	if !ok {
+		t.Fatalf("%s has no response section", path)
+	}
+	var ex readerExchange
+	var requestLine, statusLine string
+	requestLine, ex.header, ex.body = parseReaderMessage(t, path, request)
+	statusLine, ex.wantHeader, ex.wantBody = parseReaderMessage(t, path, response)
+
+	ex.method, ex.target, ok = strings.Cut(requestLine, " ")
+	if !ok {
+		t.Fatalf("%s: invalid request line %q", path, requestLine)
+	}
+	ex.status, err = strconv.Atoi(statusLine)
+	if err != nil {
+		t.Fatalf("%s: invalid status %q", path, statusLine)
+	}
+	return ex
+}
+
+func parseReaderMessage(t *testing.T, path, msg string) (string, http.Header, string) {
+	t.Helper()
+	head, body, _ := strings.Cut(msg, "\n\n")
+	scanner := bufio.NewScanner(strings.NewReader(head))
+	scanner.Scan()
+	first := scanner.Text()
+	header := http.Header{}
+	for scanner.Scan() {
+		name, value, ok := strings.Cut(scanner.Text(), ":")
+		if !ok {
+			t.Fatalf("%s: invalid header %q", path, scanner.Text())
+		}
+		header.Add(name, strings.TrimSpace(value))
+	}
+	return first, header, strings.TrimRight(body, "\n")
+}
+
+// matchJSON reports whether got has the same structure and values as want,
+// where the string "*" in want matches anything.
+func matchJSON(want, got any) bool {
+	if want == "*" {
+		return true
+	}
+	switch want := want.(type) {
+	case map[string]any:
+		got, ok := got.(map[string]any)
+		if !ok || len(got) != len(want) {
+			return false
+		}
+		for key, value := range want {
+			if _, ok := got[key]; !ok || !matchJSON(value, got[key]) {
+				return false
+			}
+		}
+		return true
+	case []any:
+		got, ok := got.([]any)
+		if !ok || len(got) != len(want) {
+			return false
+		}
+		for i := range want {
+			if !matchJSON(want[i], got[i]) {
+				return false
+			}
+		}
+		return true
+	}
+	return reflect.DeepEqual(want, got)
+}
+
+// TestReaderReplay replays requests recorded from Google Reader API clients
+// in order against a user following one of two feeds.
+func TestReaderReplay(t *testing.T) {
+	db, queries := testDB(t)
+	ctx := context.Background()
+	alice := createTestUser(t, queries, "alice")
+	bob := createTestUser(t, queries, "bob")
+	key, _, err := createAPIKey(ctx, queries, alice, "reader")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	blog := createTestFeed(t, queries, bob, "https://blog.example.com/feed.xml")
+	other := createTestFeed(t, queries, bob, "https://other.example.com/feed.xml")
+	_, err = db.Exec(`UPDATE feeds SET name = 'Example Blog' WHERE id = $1`, blog.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = queries.CreateFeedFollow(ctx, database.CreateFeedFollowParams{
+		ID:        uuid.New(),
+		CreatedAt: time.Now().UTC(),
+		UpdatedAt: time.Now().UTC(),
+		UserID:    alice.ID,
+		FeedID:    blog.ID,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = db.Exec(`UPDATE feed_follows SET category = 'Tech' WHERE user_id = $1`, alice.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	posts := []struct {
+		itemID    int64
+		feed      database.Feed
+		title     string
+		url       string
+		content   string
+		published time.Time
+	}{
+		{1, blog, "First post", "https://blog.example.com/first", "<p>One</p>", time.Date(2024, 1, 2, 9, 0, 0, 0, time.UTC)},
+		{2, blog, "Second post", "https://blog.example.com/second", "<p>Two</p>", time.Date(2024, 1, 3, 9, 0, 0, 0, time.UTC)},
+		{3, other, "Elsewhere", "https://other.example.com/post", "<p>Three</p>", time.Date(2024, 1, 3, 9, 0, 0, 0, time.UTC)},
+	}
+	for _, post := range posts {
+		// Collected an hour after publishing.
+		collected := post.published.Add(time.Hour)
+		_, err = db.Exec(`INSERT INTO posts (id, created_at, updated_at, title, url, description, published_at, feed_id, guid, item_id)
+			VALUES ($1, $2, $2, $3, $4, $5, $6, $7, $4, $8)`,
+			uuid.New(), collected, post.title, post.url, post.content, post.published, post.feed.ID, post.itemID)
+		if err != nil {
+			t.Fatalf("couldn't insert post: %v", err)
+		}
+	}
+
+	router := newRouter(&state{db: queries, cfg: &config.Config{}})
+	data := map[string]string{
+		"Key":   key,
+		"Token": strings.ReplaceAll(alice.ID.String(), "-", ""),
+	}
+	fixtures, err := filepath.Glob(filepath.Join("testdata", "reader", "*.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fixtures) == 0 {
+		t.Fatal("no fixtures in testdata/reader")
+	}
+	for _, fixture := range fixtures {
+		name := strings.TrimSuffix(filepath.Base(fixture), ".txt")
+		ex := readReaderExchange(t, fixture, data)
+
+		req := httptest.NewRequest(ex.method, ex.target, strings.NewReader(ex.body))
+		req.Header = ex.header
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+
+		if rec.Code != ex.status {
+			t.Fatalf("%s: status %d, want %d: %s", name, rec.Code, ex.status, rec.Body)
+		}
+		for header := range ex.wantHeader {
+			if got, want := rec.Header().Get(header), ex.wantHeader.Get(header); got != want {
+				t.Errorf("%s: %s = %q, want %q", name, header, got, want)
+			}
+		}
+
+		gotBody := strings.TrimRight(rec.Body.String(), "\n")
+		if !strings.HasPrefix(ex.wantHeader.Get("Content-Type"), "application/json") {
+			if gotBody != ex.wantBody {
+				t.Errorf("%s: body\n%s\nwant\n%s", name, gotBody, ex.wantBody)
+			}
+			continue
+		}
+		var want, got any
+		err := json.Unmarshal([]byte(ex.wantBody), &want)
+		if err != nil {
+			t.Fatalf("%s: invalid expected body: %v", name, err)
+		}
+		err = json.Unmarshal([]byte(gotBody), &got)
+		if err != nil {
+			t.Fatalf("%s: invalid response body: %v", name, err)
+		}
+		if !matchJSON(want, got) {
+			t.Errorf("%s: body\n%s\nwant\n%s", name, gotBody, ex.wantBody)
+		}
+	}
+
+	// edit-tag was also sent item 3, from a feed alice doesn't follow.
+	var stars int
+	err = db.QueryRow(`SELECT COUNT(*) FROM user_post_stars
+		JOIN posts ON posts.id = user_post_stars.post_id
+		WHERE posts.item_id = 3`).Scan(&stars)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stars != 0 {
+		t.Errorf("edit-tag starred an item from an unfollowed feed")
+	}
+}
+
+func TestReaderMarkAllAsReadInvalidTimestamp(t *testing.T) {
+	router, _, _, key := newTestAPI(t)
+	req := httptest.NewRequest("POST", "/reader/api/0/mark-all-as-read",
+		strings.NewReader(fmt.Sprintf("s=%s&ts=yesterday", readerStreamReadingList)))
+	req.Header.Set("Authorization", "GoogleLogin auth="+key)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("status %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+}
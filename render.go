@@ -0,0 +1,329 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/VuTLy/blogAggregator/internal/database"
+)
+
+const defaultTimelineSize = 50
+
+// rssOutput is an RSS 2.0 document as gator writes it. RSSFeed is the
+// reading side and drops the attributes written here.
+type rssOutput struct {
+	XMLName xml.Name         `xml:"rss"`
+	Version string           `xml:"version,attr"`
+	AtomNS  string           `xml:"xmlns:atom,attr"`
+	Channel rssOutputChannel `xml:"channel"`
+}
+
+type rssOutputChannel struct {
+	Title         string          `xml:"title"`
+	Link          string          `xml:"link"`
+	Description   string          `xml:"description"`
+	SelfLink      *atomOutputLink `xml:"atom:link,omitempty"`
+	LastBuildDate string          `xml:"lastBuildDate"`
+	Generator     string          `xml:"generator"`
+	Item          []rssOutputItem `xml:"item"`
+}
+
+type rssOutputItem struct {
+	Title       string    `xml:"title"`
+	Link        string    `xml:"link"`
+	Description string    `xml:"description,omitempty"`
+	GUID        rssGUID   `xml:"guid"`
+	PubDate     string    `xml:"pubDate,omitempty"`
+	Source      rssSource `xml:"source"`
+}
+
+type rssGUID struct {
+	IsPermaLink string `xml:"isPermaLink,attr"`
+	Value       string `xml:",chardata"`
+}
+
+type rssSource struct {
+	URL  string `xml:"url,attr"`
+	Name string `xml:",chardata"`
+}
+
+// atomOutput is an Atom document as gator writes it.
+type atomOutput struct {
+	XMLName   xml.Name          `xml:"http://www.w3.org/2005/Atom feed"`
+	ID        string            `xml:"id"`
+	Title     string            `xml:"title"`
+	Updated   string            `xml:"updated"`
+	Author    atomOutputPerson  `xml:"author"`
+	Generator string            `xml:"generator"`
+	Link      []atomOutputLink  `xml:"link"`
+	Entry     []atomOutputEntry `xml:"entry"`
+}
+
+type atomOutputLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr"`
+	Type string `xml:"type,attr,omitempty"`
+}
+
+type atomOutputPerson struct {
+	Name string `xml:"name"`
+}
+
+type atomOutputEntry struct {
+	ID        string           `xml:"id"`
+	Title     string           `xml:"title"`
+	Link      []atomOutputLink `xml:"link"`
+	Published string           `xml:"published,omitempty"`
+	Updated   string           `xml:"updated"`
+	Summary   *atomOutputText  `xml:"summary,omitempty"`
+	Source    atomOutputSource `xml:"source"`
+}
+
+type atomOutputText struct {
+	Type string `xml:"type,attr"`
+	Text string `xml:",chardata"`
+}
+
+// atomOutputSource credits the feed an entry was aggregated from.
+type atomOutputSource struct {
+	ID    string           `xml:"id"`
+	Title string           `xml:"title"`
+	Link  []atomOutputLink `xml:"link"`
+}
+
+// renderTimeline writes posts as an RSS 2.0 or Atom document of user's
+// timeline and returns it with its content type. siteURL is the page the
+// timeline links to and selfURL, if known, is where the document is served.
+// Entries are identified by urn:uuid post IDs, which never change for a
+// post, so readers don't show refetched posts twice.
+func renderTimeline(format string, user database.User, posts []database.GetPostsForUserRow, siteURL, selfURL string) ([]byte, string, error) {
+	title := fmt.Sprintf("gator timeline for %s", user.Name)
+	updated := timelineUpdatedAt(posts)
+
+	var doc any
+	var contentType string
+	switch format {
+	case "rss":
+		contentType = "application/rss+xml; charset=utf-8"
+		channel := rssOutputChannel{
+			Title:         title,
+			Link:          siteURL,
+			Description:   fmt.Sprintf("Posts from the feeds %s follows on gator", user.Name),
+			LastBuildDate: updated.Format(time.RFC1123Z),
+			Generator:     "gator",
+		}
+		if selfURL != "" {
+			channel.SelfLink = &atomOutputLink{
+				Href: selfURL,
+				Rel:  "self",
+				Type: "application/rss+xml",
+			}
+		}
+		for _, post := range posts {
+			item := rssOutputItem{
+				Title:       post.Title,
+				Link:        post.Url,
+				Description: post.Description.String,
+				GUID: rssGUID{
+					IsPermaLink: "false",
+					Value:       "urn:uuid:" + post.ID.String(),
+				},
+				Source: rssSource{
+					URL:  post.FeedUrl,
+					Name: post.FeedName,
+				},
+			}
+			if post.PublishedAt.Valid {
+				item.PubDate = post.PublishedAt.Time.Format(time.RFC1123Z)
+			}
+			channel.Item = append(channel.Item, item)
+		}
+		doc = rssOutput{
+			Version: "2.0",
+			AtomNS:  atomNamespace,
+			Channel: channel,
+		}
+
+	case "atom":
+		contentType = "application/atom+xml; charset=utf-8"
+		feed := atomOutput{
+			ID:        "urn:uuid:" + user.ID.String(),
+			Title:     title,
+			Updated:   updated.Format(time.RFC3339),
+			Author:    atomOutputPerson{Name: user.Name},
+			Generator: "gator",
+			Link: []atomOutputLink{{
+				Href: siteURL,
+				Rel:  "alternate",
+				Type: "text/html",
+			}},
+		}
+		if selfURL != "" {
+			feed.Link = append(feed.Link, atomOutputLink{
+				Href: selfURL,
+				Rel:  "self",
+				Type: "application/atom+xml",
+			})
+		}
+		for _, post := range posts {
+			entry := atomOutputEntry{
+				ID:      "urn:uuid:" + post.ID.String(),
+				Title:   post.Title,
+				Link:    []atomOutputLink{{Href: post.Url, Rel: "alternate"}},
+				Updated: post.UpdatedAt.UTC().Format(time.RFC3339),
+				Source: atomOutputSource{
+					ID:    post.FeedUrl,
+					Title: post.FeedName,
+					Link:  []atomOutputLink{{Href: post.FeedUrl, Rel: "self"}},
+				},
+			}
+			if post.PublishedAt.Valid {
+				entry.Published = post.PublishedAt.Time.Format(time.RFC3339)
+			}
+			if post.Description.Valid && post.Description.String != "" {
+				entry.Summary = &atomOutputText{
+					Type: "html",
+					Text: post.Description.String,
+				}
+			}
+			feed.Entry = append(feed.Entry, entry)
+		}
+		doc = feed
+
+	default:
+		return nil, "", fmt.Errorf("unknown format %q: must be rss or atom", format)
+	}
+
+	dat, err := xml.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return nil, "", fmt.Errorf("couldn't encode %s: %w", format, err)
+	}
+	return append([]byte(xml.Header), append(dat, '\n')...), contentType, nil
+}
+
+// timelineUpdatedAt is when the newest change to posts happened, which is
+// the document's last modification time.
+func timelineUpdatedAt(posts []database.GetPostsForUserRow) time.Time {
+	var updated time.Time
+	for _, post := range posts {
+		if post.UpdatedAt.After(updated) {
+			updated = post.UpdatedAt
+		}
+	}
+	if updated.IsZero() {
+		return time.Unix(0, 0).UTC()
+	}
+	return updated.UTC()
+}
+
+func handlerRender(s *state, cmd command, user database.User) error {
+	fs := flag.NewFlagSet(cmd.Name, flag.ContinueOnError)
+	limit := fs.Int("limit", defaultTimelineSize, "number of posts to include")
+	siteURL := fs.String("url", "http://localhost:8080", "base URL of the gator server the document links to")
+	output := fs.String("output", "", "write the document to this file instead of stdout")
+	args, err := parseFlags(fs, cmd.Args)
+	if err != nil {
+		return err
+	}
+	if len(args) > 1 {
+		return fmt.Errorf("usage: %s [rss|atom] [--limit n] [--url base] [--output file]", cmd.Name)
+	}
+
+	format := "rss"
+	if len(args) == 1 {
+		format = args[0]
+	}
+
+	posts, err := s.db.GetPostsForUser(context.Background(), database.GetPostsForUserParams{
+		UserID: user.ID,
+		Limit:  int32(*limit),
+	})
+	if err != nil {
+		return fmt.Errorf("couldn't get posts for user: %w", err)
+	}
+
+	base := strings.TrimSuffix(*siteURL, "/")
+	dat, _, err := renderTimeline(format, user, posts, base+"/", base+"/v1/timeline/"+format)
+	if err != nil {
+		return err
+	}
+
+	var out io.Writer = os.Stdout
+	if *output != "" {
+		file, err := os.Create(*output)
+		if err != nil {
+			return fmt.Errorf("couldn't create output file: %w", err)
+		}
+		defer file.Close()
+		out = file
+	}
+
+	_, err = out.Write(dat)
+	if err != nil {
+		return fmt.Errorf("couldn't write %s: %w", format, err)
+	}
+
+	if *output != "" {
+		fmt.Printf("Rendered %d posts to %s\n", len(posts), *output)
+	}
+	return nil
+}
+
+// apiTimeline serves the user's timeline as RSS or Atom. Responses carry an
+// ETag and Last-Modified so readers polling it get a 304 until a post
+// changes.
+func apiTimeline(s *state, w http.ResponseWriter, r *http.Request, user database.User) {
+	format := r.PathValue("format")
+	if format != "rss" && format != "atom" {
+		respondWithError(w, http.StatusNotFound, "format must be rss or atom")
+		return
+	}
+
+	limit := defaultTimelineSize
+	if value := r.URL.Query().Get("limit"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 || n > maxPageSize {
+			respondWithError(w, http.StatusBadRequest, fmt.Sprintf("limit must be between 1 and %d", maxPageSize))
+			return
+		}
+		limit = n
+	}
+
+	posts, err := s.db.GetPostsForUser(r.Context(), database.GetPostsForUserParams{
+		UserID: user.ID,
+		Limit:  int32(limit),
+	})
+	if err != nil {
+		respondWithInternalError(w, "couldn't get posts", err)
+		return
+	}
+
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	base := scheme + "://" + r.Host
+	dat, contentType, err := renderTimeline(format, user, posts, base+"/", base+r.URL.Path)
+	if err != nil {
+		respondWithInternalError(w, "couldn't render timeline", err)
+		return
+	}
+
+	sum := sha256.Sum256(dat)
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("ETag", `"`+hex.EncodeToString(sum[:16])+`"`)
+	// The timeline is per user, so shared caches mustn't keep it.
+	w.Header().Set("Cache-Control", "private, max-age=300")
+	http.ServeContent(w, r, "", timelineUpdatedAt(posts), bytes.NewReader(dat))
+}
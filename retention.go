@@ -0,0 +1,193 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"flag"
+	"fmt"
+	"log"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/VuTLy/blogAggregator/internal/database"
+)
+
+func handlerPrune(s *state, cmd command) error {
+	fs := flag.NewFlagSet(cmd.Name, flag.ContinueOnError)
+	maxAge := fs.String("max-age", "0", "delete posts older than this (e.g. 720h, 30d) in feeds without their own limit; 0 keeps them")
+	dryRun := fs.Bool("dry-run", false, "report what would be deleted without deleting anything")
+	args, err := parseFlags(fs, cmd.Args)
+	if err != nil {
+		return err
+	}
+	if len(args) != 0 {
+		return fmt.Errorf("usage: %s [--max-age d] [--dry-run]", cmd.Name)
+	}
+
+	defaultMaxAge, err := parseMaxAge(*maxAge)
+	if err != nil {
+		return fmt.Errorf("invalid --max-age: %w", err)
+	}
+
+	counts, err := prunePosts(context.Background(), s.db, defaultMaxAge, *dryRun)
+	if err != nil {
+		return err
+	}
+
+	verb := "Deleted"
+	if *dryRun {
+		verb = "Would delete"
+	}
+	total := int64(0)
+	for _, count := range counts {
+		fmt.Printf("* %s (%s): %d posts\n", count.FeedName, count.FeedUrl, count.PostCount)
+		total += count.PostCount
+	}
+	fmt.Printf("%s %d posts from %d feeds.\n", verb, total, len(counts))
+	return nil
+}
+
+// prunePosts deletes, or with dryRun only counts, the posts that are past
+// their feed's retention limits. Feeds without a max age of their own use
+// defaultMaxAge, where 0 means no limit, and which parseMaxAge has checked
+// fits the database. Starred posts are always kept. Posts a follower hasn't
+// read or hidden yet are kept past the max count, but not past the max age,
+// so a follower who never reads can't keep a feed's posts forever.
+func prunePosts(ctx context.Context, db *database.Queries, defaultMaxAge time.Duration, dryRun bool) ([]database.CountPrunablePostsRow, error) {
+	if dryRun {
+		counts, err := db.CountPrunablePosts(ctx, int32(defaultMaxAge.Seconds()))
+		if err != nil {
+			return nil, fmt.Errorf("couldn't count prunable posts: %w", err)
+		}
+		return counts, nil
+	}
+
+	deleted, err := db.DeletePrunablePosts(ctx, int32(defaultMaxAge.Seconds()))
+	if err != nil {
+		return nil, fmt.Errorf("couldn't delete posts: %w", err)
+	}
+	counts := make([]database.CountPrunablePostsRow, 0, len(deleted))
+	for _, row := range deleted {
+		counts = append(counts, database.CountPrunablePostsRow(row))
+	}
+	return counts, nil
+}
+
+// runRetention is the agg-side retention job.
+func runRetention(ctx context.Context, db *database.Queries, defaultMaxAge time.Duration) {
+	counts, err := prunePosts(ctx, db, defaultMaxAge, false)
+	if err != nil {
+		log.Printf("Couldn't prune posts: %v", err)
+		return
+	}
+	total := int64(0)
+	for _, count := range counts {
+		total += count.PostCount
+	}
+	log.Printf("Pruned %d posts from %d feeds", total, len(counts))
+}
+
+// handlerRetention sets the limits given as flags and leaves the others as
+// they are. Without any flags it shows the feed's current limits.
+func handlerRetention(s *state, cmd command) error {
+	fs := flag.NewFlagSet(cmd.Name, flag.ContinueOnError)
+	maxAge := fs.String("max-age", "0", "keep posts for this long (e.g. 720h, 30d); 0 uses the global setting")
+	maxCount := fs.Int("max-count", 0, "keep at most this many posts; 0 means no limit")
+	args, err := parseFlags(fs, cmd.Args)
+	if err != nil {
+		return err
+	}
+	if len(args) != 1 {
+		return fmt.Errorf("usage: %s <feed_url> [--max-age d] [--max-count n]", cmd.Name)
+	}
+
+	set := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) { set[f.Name] = true })
+
+	age, err := parseMaxAge(*maxAge)
+	if err != nil {
+		return fmt.Errorf("invalid --max-age: %w", err)
+	}
+	if *maxCount < 0 || *maxCount > math.MaxInt32 {
+		return fmt.Errorf("invalid --max-count: must be between 0 and %d", math.MaxInt32)
+	}
+
+	if !set["max-age"] && !set["max-count"] {
+		feed, err := s.db.GetFeedByURL(context.Background(), args[0])
+		if err != nil {
+			return fmt.Errorf("couldn't get feed: %w", err)
+		}
+		fmt.Printf("Retention for %s:\n", feed.Name)
+		printRetention(feed)
+		return nil
+	}
+
+	feed, err := s.db.SetFeedRetention(context.Background(), database.SetFeedRetentionParams{
+		Url:       args[0],
+		SetMaxAge: set["max-age"],
+		MaxPostAgeSeconds: sql.NullInt32{
+			Int32: int32(age.Seconds()),
+			Valid: age > 0,
+		},
+		SetMaxPosts: set["max-count"],
+		MaxPosts: sql.NullInt32{
+			Int32: int32(*maxCount),
+			Valid: *maxCount > 0,
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("couldn't set retention: %w", err)
+	}
+
+	fmt.Printf("Retention for %s updated:\n", feed.Name)
+	printRetention(feed)
+	return nil
+}
+
+func printRetention(feed database.Feed) {
+	if feed.MaxPostAgeSeconds.Valid {
+		fmt.Printf("* MaxAge:        %v\n", time.Duration(feed.MaxPostAgeSeconds.Int32)*time.Second)
+	} else {
+		fmt.Printf("* MaxAge:        global\n")
+	}
+	if feed.MaxPosts.Valid {
+		fmt.Printf("* MaxPosts:      %d\n", feed.MaxPosts.Int32)
+	} else {
+		fmt.Printf("* MaxPosts:      unlimited\n")
+	}
+}
+
+// parseLongDuration is time.ParseDuration plus a "d" suffix for whole days,
+// since retention periods and browse windows are usually given in days.
+func parseLongDuration(value string) (time.Duration, error) {
+	if days, ok := strings.CutSuffix(value, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil {
+			return 0, fmt.Errorf("invalid number of days %q", days)
+		}
+		if day := int64(24 * time.Hour); int64(n) > math.MaxInt64/day || int64(n) < math.MinInt64/day {
+			return 0, fmt.Errorf("%d days is out of range", n)
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+	return time.ParseDuration(value)
+}
+
+// maxRetention is the longest max age the database can store in seconds,
+// about 68 years.
+const maxRetention = math.MaxInt32 * time.Second
+
+// parseMaxAge parses a retention max age, which must fit the database's
+// column so it can't wrap around to a negative age that turns pruning off.
+func parseMaxAge(value string) (time.Duration, error) {
+	age, err := parseLongDuration(value)
+	if err != nil {
+		return 0, err
+	}
+	if age < 0 || age > maxRetention {
+		return 0, fmt.Errorf("must be between 0 and %dd", maxRetention/(24*time.Hour))
+	}
+	return age, nil
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/VuTLy/blogAggregator/internal/database"
+)
+
+func TestParseMaxAge(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    time.Duration
+		wantErr bool
+	}{
+		{"0", 0, false},
+		{"720h", 720 * time.Hour, false},
+		{"30d", 30 * 24 * time.Hour, false},
+		{"24855d", 24855 * 24 * time.Hour, false},
+		{"24856d", 0, true},
+		{"600000h", 0, true},
+		{"200000d", 0, true},
+		{"-1d", 0, true},
+		{"soon", 0, true},
+	}
+	for _, tt := range tests {
+		got, err := parseMaxAge(tt.value)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseMaxAge(%q) err = %v, want error %t", tt.value, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("parseMaxAge(%q) = %s, want %s", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestHandlerRetentionKeepsUnsetLimits(t *testing.T) {
+	_, queries := testDB(t)
+	s := &state{db: queries}
+	user := createTestUser(t, queries, "alice")
+	feed := createTestFeed(t, queries, user, "https://example.com/feed.xml")
+
+	steps := []struct {
+		args        []string
+		wantAge     time.Duration
+		wantMaxPost int32
+	}{
+		{[]string{feed.Url, "--max-age", "30d"}, 30 * 24 * time.Hour, 0},
+		{[]string{feed.Url, "--max-count", "50"}, 30 * 24 * time.Hour, 50},
+		{[]string{feed.Url}, 30 * 24 * time.Hour, 50},
+		{[]string{feed.Url, "--max-age", "0"}, 0, 50},
+		{[]string{feed.Url, "--max-count", "0", "--max-age", "7d"}, 7 * 24 * time.Hour, 0},
+	}
+	for i, step := range steps {
+		err := handlerRetention(s, command{Name: "retention", Args: step.args})
+		if err != nil {
+			t.Fatalf("step %d: handlerRetention: %v", i, err)
+		}
+		got, err := queries.GetFeedByURL(context.Background(), feed.Url)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if age := time.Duration(got.MaxPostAgeSeconds.Int32) * time.Second; age != step.wantAge {
+			t.Errorf("step %d: max age = %s, want %s", i, age, step.wantAge)
+		}
+		if got.MaxPosts.Int32 != step.wantMaxPost {
+			t.Errorf("step %d: max posts = %d, want %d", i, got.MaxPosts.Int32, step.wantMaxPost)
+		}
+	}
+}
+
+func TestPrunePostsReportsFeedsSeparately(t *testing.T) {
+	db, queries := testDB(t)
+	user := createTestUser(t, queries, "alice")
+
+	// Two feeds that happen to share a name.
+	for _, feedURL := range []string{"https://a.example.com/feed.xml", "https://b.example.com/feed.xml"} {
+		feed := createTestFeed(t, queries, user, feedURL)
+		createTestPost(t, queries, feed, "Old")
+		createTestPost(t, queries, feed, "New")
+	}
+	_, err := db.Exec(`UPDATE feeds SET name = 'Blog'`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = db.Exec(`UPDATE posts SET published_at = NOW() - INTERVAL '100 days' WHERE title = 'Old'`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, dryRun := range []bool{true, false} {
+		counts, err := prunePosts(context.Background(), queries, 30*24*time.Hour, dryRun)
+		if err != nil {
+			t.Fatalf("prunePosts(dryRun=%t): %v", dryRun, err)
+		}
+		if len(counts) != 2 {
+			t.Fatalf("prunePosts(dryRun=%t) reported %d feeds, want 2: %+v", dryRun, len(counts), counts)
+		}
+		for _, count := range counts {
+			if count.PostCount != 1 {
+				t.Errorf("prunePosts(dryRun=%t) reported %d posts for %s, want 1", dryRun, count.PostCount, count.FeedUrl)
+			}
+		}
+	}
+}
+
+func TestPrunePostsKeepsUnreadPostsOnlyPastMaxCount(t *testing.T) {
+	db, queries := testDB(t)
+	ctx := context.Background()
+	user := createTestUser(t, queries, "alice")
+	feed := createTestFeed(t, queries, user, "https://example.com/feed.xml")
+	createTestFeedFollow(t, queries, user, feed)
+
+	expired := createTestPost(t, queries, feed, "Expired")
+	unread := createTestPost(t, queries, feed, "Unread")
+	hidden := createTestPost(t, queries, feed, "Hidden")
+	createTestPost(t, queries, feed, "Newest")
+	_, err := db.Exec(`UPDATE posts SET published_at = published_at - CASE title
+		WHEN 'Expired' THEN INTERVAL '100 days'
+		WHEN 'Unread' THEN INTERVAL '3 days'
+		WHEN 'Hidden' THEN INTERVAL '2 days'
+		ELSE INTERVAL '0 days'
+	END`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = db.Exec(`UPDATE feeds SET max_posts = 1 WHERE id = $1`, feed.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = queries.HidePost(ctx, database.HidePostParams{UserID: user.ID, PostID: hidden.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// alice never reads anything, which keeps the unread post past the max
+	// count but not the expired one past the max age. Hiding a post counts
+	// as dealing with it.
+	_, err = prunePosts(ctx, queries, 30*24*time.Hour, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, post := range []database.Post{expired, unread, hidden} {
+		var exists bool
+		err := db.QueryRow(`SELECT EXISTS (SELECT 1 FROM posts WHERE id = $1)`, post.ID).Scan(&exists)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := post.ID == unread.ID; exists != want {
+			t.Errorf("%s post kept = %t, want %t", post.Title, exists, want)
+		}
+	}
+}
@@ -1,11 +1,17 @@
 package main
 
 import (
+	"bytes"
 	"context"
 	"encoding/xml"
+	"errors"
+	"fmt"
 	"html"
 	"io"
 	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
 	"time"
 )
 
@@ -15,6 +21,11 @@ type RSSFeed struct {
 		Link        string    `xml:"link"`
 		Description string    `xml:"description"`
 		Item        []RSSItem `xml:"item"`
+		// TTL, SkipHours and SkipDays are the channel's polling hints. They
+		// are kept as text so a malformed hint can't fail the whole feed.
+		TTL       string   `xml:"ttl"`
+		SkipHours []string `xml:"skipHours>hour"`
+		SkipDays  []string `xml:"skipDays>day"`
 	} `xml:"channel"`
 }
 
@@ -23,42 +34,240 @@ type RSSItem struct {
 	Link        string `xml:"link"`
 	Description string `xml:"description"`
 	PubDate     string `xml:"pubDate"`
+	GUID        string `xml:"guid"`
+	// Updated and DCDate are fallbacks for items without a usable pubDate:
+	// atom:updated and dc:date are common extensions in RSS feeds, and the
+	// other formats map their modified and dc:date fields here too.
+	Updated string `xml:"http://www.w3.org/2005/Atom updated"`
+	DCDate  string `xml:"http://purl.org/dc/elements/1.1/ date"`
+	// Author is RSS's "email (Name)" author. DCCreator is dc:creator, which
+	// most blogs use instead, and which the other formats map their author
+	// names to.
+	Author    string `xml:"author"`
+	DCCreator string `xml:"http://purl.org/dc/elements/1.1/ creator"`
 }
 
-func fetchFeed(ctx context.Context, feedURL string) (*RSSFeed, error) {
-	httpClient := http.Client{
-		Timeout: 10 * time.Second,
+// itemGUID identifies an item within its feed. Items without a guid or Atom
+// id fall back to their link, then their title.
+func itemGUID(item RSSItem) string {
+	for _, value := range []string{item.GUID, item.Link, item.Title} {
+		if value = strings.TrimSpace(value); value != "" {
+			return value
+		}
 	}
-	req, err := http.NewRequestWithContext(ctx, "GET", feedURL, nil)
+	return ""
+}
+
+// itemAuthor is the name of an item's author, or "" if it has none.
+func itemAuthor(item RSSItem) string {
+	if creator := strings.TrimSpace(item.DCCreator); creator != "" {
+		return creator
+	}
+	author := strings.TrimSpace(item.Author)
+	if open := strings.Index(author, "("); open > 0 && strings.HasSuffix(author, ")") {
+		if name := strings.TrimSpace(author[open+1 : len(author)-1]); name != "" {
+			return name
+		}
+	}
+	return author
+}
+
+// feedFormat is one syndication format that can be decoded into the RSS
+// model scrapeFeed stores.
+type feedFormat interface {
+	// matches reports whether a document with the given XML root element
+	// (zero for non-XML bodies) and body is in this format. The
+	// Content-Type isn't considered, since servers so often get it wrong.
+	matches(root xml.Name, dat []byte) bool
+	parse(dat []byte) (*RSSFeed, error)
+}
+
+// feedFormats is checked in order, and the first format that matches a
+// document parses it.
+var feedFormats = []feedFormat{
+	jsonFeedFormat{},
+	atomFeedFormat{},
+	rdfFeedFormat{},
+	rssFeedFormat{},
+}
+
+type rssFeedFormat struct{}
+
+func (rssFeedFormat) matches(root xml.Name, dat []byte) bool {
+	return root.Local == "rss"
+}
+
+func (rssFeedFormat) parse(dat []byte) (*RSSFeed, error) {
+	var rssFeed RSSFeed
+	err := xml.Unmarshal(dat, &rssFeed)
 	if err != nil {
 		return nil, err
 	}
+	return &rssFeed, nil
+}
 
-	req.Header.Set("User-Agent", "gator")
-	resp, err := httpClient.Do(req)
+var errUnknownFeedFormat = errors.New("unrecognized feed format")
+
+// parseFeed sniffs the document's body and root element to pick a feed
+// format, then decodes the document with it.
+func parseFeed(dat []byte) (*RSSFeed, error) {
+	root, rootErr := rootElement(dat)
+	for _, format := range feedFormats {
+		if !format.matches(root, dat) {
+			continue
+		}
+
+		rssFeed, err := format.parse(dat)
+		if err != nil {
+			return nil, err
+		}
+
+		rssFeed.Channel.Title = html.UnescapeString(rssFeed.Channel.Title)
+		rssFeed.Channel.Description = html.UnescapeString(rssFeed.Channel.Description)
+		for i, item := range rssFeed.Channel.Item {
+			item.Title = html.UnescapeString(item.Title)
+			item.Description = html.UnescapeString(item.Description)
+			item.Author = html.UnescapeString(item.Author)
+			item.DCCreator = html.UnescapeString(item.DCCreator)
+			rssFeed.Channel.Item[i] = item
+		}
+		return rssFeed, nil
+	}
+
+	// Nothing matched, so say why: a document that failed to decode as XML
+	// gets the decoder's error, and one that did gets its root element.
+	if rootErr != nil {
+		return nil, fmt.Errorf("%w: %w", errUnknownFeedFormat, rootErr)
+	}
+	return nil, fmt.Errorf("%w: root element <%s>", errUnknownFeedFormat, root.Local)
+}
+
+// rootElement returns the name of the first element in an XML document. If
+// dat is not XML it returns the zero name and the reason.
+func rootElement(dat []byte) (xml.Name, error) {
+	decoder := xml.NewDecoder(bytes.NewReader(dat))
+	for {
+		tok, err := decoder.Token()
+		if errors.Is(err, io.EOF) {
+			return xml.Name{}, errors.New("no root element")
+		}
+		if err != nil {
+			return xml.Name{}, fmt.Errorf("not XML: %w", err)
+		}
+		switch tok := tok.(type) {
+		case xml.StartElement:
+			return tok.Name, nil
+		case xml.CharData:
+			if len(bytes.TrimSpace(tok)) > 0 {
+				return xml.Name{}, errors.New("not XML: text before the root element")
+			}
+		}
+	}
+}
+
+// errNotModified is returned by fetchDocument when the server answers a
+// conditional request with 304 Not Modified.
+var errNotModified = errors.New("feed not modified")
+
+// httpStatusError is returned by fetchDocument for non-2xx responses other than
+// 304 Not Modified.
+type httpStatusError struct {
+	StatusCode int
+	// RetryAfter is how long the server asked us to wait, if it did.
+	RetryAfter time.Duration
+}
+
+func (e *httpStatusError) Error() string {
+	return fmt.Sprintf("unexpected status %d %s", e.StatusCode, http.StatusText(e.StatusCode))
+}
+
+// parseRetryAfter parses a Retry-After header given in either delay-seconds
+// or HTTP-date form.
+func parseRetryAfter(value string, now time.Time) time.Duration {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if t, err := http.ParseTime(value); err == nil && t.After(now) {
+		return t.Sub(now)
+	}
+	return 0
+}
+
+// feedValidators are the cache validators from a previous response, sent
+// back as If-None-Match and If-Modified-Since on the next fetch.
+type feedValidators struct {
+	ETag         string
+	LastModified string
+}
+
+func fetchFeed(ctx context.Context, client *http.Client, feedURL string, validators feedValidators) (*RSSFeed, feedValidators, error) {
+	doc, err := fetchDocument(ctx, client, feedURL, validators)
 	if err != nil {
-		return nil, err
+		return nil, validators, err
 	}
-	defer resp.Body.Close()
 
-	dat, err := io.ReadAll(resp.Body)
+	rssFeed, err := parseFeed(doc.Body)
+	if err != nil {
+		return nil, validators, err
+	}
+
+	return rssFeed, doc.Validators, nil
+}
+
+// fetchedDocument is a downloaded feed or web page.
+type fetchedDocument struct {
+	// URL is where the document was found, after following redirects.
+	URL         *url.URL
+	ContentType string
+	Body        []byte
+	Validators  feedValidators
+}
+
+func fetchDocument(ctx context.Context, client *http.Client, docURL string, validators feedValidators) (*fetchedDocument, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", docURL, nil)
 	if err != nil {
 		return nil, err
 	}
 
-	var rssFeed RSSFeed
-	err = xml.Unmarshal(dat, &rssFeed)
+	req.Header.Set("User-Agent", "gator")
+	if validators.ETag != "" {
+		req.Header.Set("If-None-Match", validators.ETag)
+	}
+	if validators.LastModified != "" {
+		req.Header.Set("If-Modified-Since", validators.LastModified)
+	}
+	resp, err := client.Do(req)
 	if err != nil {
 		return nil, err
 	}
+	defer resp.Body.Close()
 
-	rssFeed.Channel.Title = html.UnescapeString(rssFeed.Channel.Title)
-	rssFeed.Channel.Description = html.UnescapeString(rssFeed.Channel.Description)
-	for i, item := range rssFeed.Channel.Item {
-		item.Title = html.UnescapeString(item.Title)
-		item.Description = html.UnescapeString(item.Description)
-		rssFeed.Channel.Item[i] = item
+	if resp.StatusCode == http.StatusNotModified {
+		return nil, errNotModified
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, &httpStatusError{
+			StatusCode: resp.StatusCode,
+			RetryAfter: parseRetryAfter(resp.Header.Get("Retry-After"), time.Now()),
+		}
 	}
 
-	return &rssFeed, nil
+	dat, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	return &fetchedDocument{
+		URL:         resp.Request.URL,
+		ContentType: resp.Header.Get("Content-Type"),
+		Body:        dat,
+		Validators: feedValidators{
+			ETag:         resp.Header.Get("ETag"),
+			LastModified: resp.Header.Get("Last-Modified"),
+		},
+	}, nil
 }
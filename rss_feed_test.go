@@ -0,0 +1,94 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestParseFeedSniffsFormat(t *testing.T) {
+	const rss = `<?xml version="1.0"?><rss version="2.0"><channel><title>RSS</title><item><title>One</title></item></channel></rss>`
+	const jsonFeed = `{"version": "https://jsonfeed.org/version/1.1", "title": "JSON", "items": [{"id": "1", "title": "One"}]}`
+
+	tests := []struct {
+		name      string
+		body      string
+		wantTitle string
+	}{
+		{"rss", rss, "RSS"},
+		{"json feed", jsonFeed, "JSON"},
+		{"json feed with whitespace and bom", "\xef\xbb\xbf\n  " + jsonFeed, "JSON"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			feed, err := parseFeed([]byte(tt.body))
+			if err != nil {
+				t.Fatalf("parseFeed: %v", err)
+			}
+			if feed.Channel.Title != tt.wantTitle {
+				t.Errorf("title = %q, want %q", feed.Channel.Title, tt.wantTitle)
+			}
+			if len(feed.Channel.Item) != 1 || feed.Channel.Item[0].Title != "One" {
+				t.Errorf("items = %+v, want one titled One", feed.Channel.Item)
+			}
+		})
+	}
+}
+
+func TestParseFeedErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		// wantErr is part of the error message, and notErr must not be.
+		wantErr string
+		notErr  string
+	}{
+		{
+			name:    "html page",
+			body:    "<!DOCTYPE html>\n<html><head><title>Blog</title></head></html>",
+			wantErr: "root element <html>",
+			notErr:  "invalid character",
+		},
+		{
+			name:    "undeclared charset",
+			body:    `<?xml version="1.0" encoding="windows-1252"?><rss version="2.0"></rss>`,
+			wantErr: "windows-1252",
+			notErr:  "invalid character",
+		},
+		{
+			name:    "malformed rss",
+			body:    `<rss version="2.0"><channel><title>Broken</channel></rss>`,
+			wantErr: "XML syntax error",
+			notErr:  "invalid character",
+		},
+		{
+			name:    "malformed json feed",
+			body:    `{"version": "https://jsonfeed.org/version/1.1", "items": [}`,
+			wantErr: "invalid character",
+		},
+		{
+			name:    "plain text",
+			body:    "Service Unavailable",
+			wantErr: "not XML",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parseFeed([]byte(tt.body))
+			if err == nil {
+				t.Fatal("parseFeed succeeded, want an error")
+			}
+			if !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("err = %q, want it to mention %q", err, tt.wantErr)
+			}
+			if tt.notErr != "" && strings.Contains(err.Error(), tt.notErr) {
+				t.Errorf("err = %q, shouldn't mention %q", err, tt.notErr)
+			}
+		})
+	}
+
+	_, err := parseFeed([]byte("<html></html>"))
+	if !errors.Is(err, errUnknownFeedFormat) {
+		t.Errorf("html page: err = %v, want %v", err, errUnknownFeedFormat)
+	}
+}
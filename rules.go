@@ -0,0 +1,420 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"html"
+	"log"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/VuTLy/blogAggregator/internal/database"
+	"github.com/google/uuid"
+)
+
+// hideBatchSize is how many stored posts hideMatchingPosts checks at once.
+const hideBatchSize = 500
+
+var (
+	ruleFields  = []string{"title", "description", "feed", "author"}
+	ruleMatches = []string{"substring", "regex", "word"}
+	ruleActions = []string{"hide", "mark-read", "star", "notify"}
+)
+
+// postRule is a rule ready to be matched against posts. Substring and word
+// rules ignore case; regex rules are used as written, so add (?i) to them
+// for that.
+type postRule struct {
+	database.Rule
+	needle string
+	re     *regexp.Regexp
+}
+
+// ruleSubject is the text of a post that rules match against.
+type ruleSubject struct {
+	Title       string
+	Description string
+	FeedName    string
+	FeedURL     string
+	Author      string
+}
+
+func compileRule(rule database.Rule) (postRule, error) {
+	compiled := postRule{Rule: rule}
+	var err error
+	switch rule.MatchType {
+	case "substring":
+		compiled.needle = strings.ToLower(rule.Pattern)
+	case "word":
+		compiled.re, err = regexp.Compile(`(?i)(^|\W)` + regexp.QuoteMeta(rule.Pattern) + `($|\W)`)
+	case "regex":
+		compiled.re, err = regexp.Compile(rule.Pattern)
+	default:
+		err = fmt.Errorf("unknown match type %q", rule.MatchType)
+	}
+	if err != nil {
+		return postRule{}, err
+	}
+	return compiled, nil
+}
+
+func (r postRule) matches(subject ruleSubject) bool {
+	var values []string
+	switch r.Field {
+	case "title":
+		values = []string{subject.Title}
+	case "description":
+		values = []string{strings.Join(strings.Fields(html.UnescapeString(tagPattern.ReplaceAllString(subject.Description, " "))), " ")}
+	case "feed":
+		values = []string{subject.FeedName, subject.FeedURL}
+	case "author":
+		values = []string{subject.Author}
+	}
+
+	for _, value := range values {
+		if r.re != nil && r.re.MatchString(value) {
+			return true
+		}
+		if r.re == nil && r.needle != "" && strings.Contains(strings.ToLower(value), r.needle) {
+			return true
+		}
+	}
+	return false
+}
+
+func handlerRule(s *state, cmd command, user database.User) error {
+	usage := fmt.Errorf("usage: %s add <pattern> [--field f] [--match m] [--action a] | list | rm <id>", cmd.Name)
+	if len(cmd.Args) == 0 {
+		return usage
+	}
+
+	sub := command{Name: cmd.Name + " " + cmd.Args[0], Args: cmd.Args[1:]}
+	switch cmd.Args[0] {
+	case "add":
+		return handlerRuleAdd(s, sub, user)
+	case "list":
+		return handlerRuleList(s, sub, user)
+	case "rm":
+		return handlerRuleRemove(s, sub, user)
+	default:
+		return usage
+	}
+}
+
+func handlerRuleAdd(s *state, cmd command, user database.User) error {
+	fs := flag.NewFlagSet(cmd.Name, flag.ContinueOnError)
+	field := fs.String("field", "title", "what to match: "+strings.Join(ruleFields, ", "))
+	match := fs.String("match", "substring", "how to match: "+strings.Join(ruleMatches, ", "))
+	action := fs.String("action", "hide", "what to do with matching posts: "+strings.Join(ruleActions, ", "))
+	args, err := parseFlags(fs, cmd.Args)
+	if err != nil {
+		return err
+	}
+	if len(args) != 1 || args[0] == "" {
+		return fmt.Errorf("usage: %s <pattern> [--field f] [--match m] [--action a]", cmd.Name)
+	}
+	if !slices.Contains(ruleFields, *field) {
+		return fmt.Errorf("unknown field %q: must be one of %s", *field, strings.Join(ruleFields, ", "))
+	}
+	if !slices.Contains(ruleMatches, *match) {
+		return fmt.Errorf("unknown match type %q: must be one of %s", *match, strings.Join(ruleMatches, ", "))
+	}
+	if !slices.Contains(ruleActions, *action) {
+		return fmt.Errorf("unknown action %q: must be one of %s", *action, strings.Join(ruleActions, ", "))
+	}
+
+	rule := database.CreateRuleParams{
+		ID:        uuid.New(),
+		CreatedAt: time.Now().UTC(),
+		UserID:    user.ID,
+		Field:     *field,
+		MatchType: *match,
+		Pattern:   args[0],
+		Action:    *action,
+	}
+	_, err = compileRule(database.Rule(rule))
+	if err != nil {
+		return fmt.Errorf("invalid pattern: %w", err)
+	}
+
+	created, err := s.db.CreateRule(context.Background(), rule)
+	if err != nil {
+		return fmt.Errorf("couldn't create rule: %w", err)
+	}
+
+	fmt.Println("Rule added:")
+	printRule(created)
+	fmt.Println("It applies to posts as they're collected.")
+
+	if created.Action == "hide" {
+		hidden, err := hideMatchingPosts(context.Background(), s.db, user, uuid.NullUUID{})
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Hid %d posts already collected. Use browse --show-hidden to see them.\n", hidden)
+	}
+
+	if created.Action == "notify" {
+		webhooks, err := s.db.GetWebhooksForUser(context.Background(), user.ID)
+		if err != nil {
+			return fmt.Errorf("couldn't get webhooks: %w", err)
+		}
+		if len(webhooks) == 0 {
+			fmt.Println("Notifications are sent to your webhooks, and you don't have any yet: add one with webhook add.")
+		}
+	}
+	return nil
+}
+
+func handlerRuleList(s *state, cmd command, user database.User) error {
+	if len(cmd.Args) != 0 {
+		return fmt.Errorf("usage: %s", cmd.Name)
+	}
+
+	rules, err := s.db.GetRulesForUser(context.Background(), user.ID)
+	if err != nil {
+		return fmt.Errorf("couldn't get rules: %w", err)
+	}
+
+	if len(rules) == 0 {
+		fmt.Println("No rules found.")
+		return nil
+	}
+
+	fmt.Printf("Found %d rules for %s:\n", len(rules), user.Name)
+	for _, rule := range rules {
+		printRule(rule)
+	}
+	return nil
+}
+
+func handlerRuleRemove(s *state, cmd command, user database.User) error {
+	if len(cmd.Args) != 1 {
+		return fmt.Errorf("usage: %s <id>", cmd.Name)
+	}
+
+	rules, err := s.db.GetRulesForUser(context.Background(), user.ID)
+	if err != nil {
+		return fmt.Errorf("couldn't get rules: %w", err)
+	}
+
+	// Rules are listed by the start of their ID, so any unambiguous prefix
+	// picks one.
+	var matched []database.Rule
+	for _, rule := range rules {
+		if strings.HasPrefix(rule.ID.String(), strings.ToLower(cmd.Args[0])) {
+			matched = append(matched, rule)
+		}
+	}
+	switch len(matched) {
+	case 0:
+		return fmt.Errorf("no rule matches %s", cmd.Args[0])
+	case 1:
+	default:
+		return fmt.Errorf("%s matches %d rules, give more of the ID", cmd.Args[0], len(matched))
+	}
+
+	ctx := context.Background()
+	tx, err := s.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("couldn't begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+	qtx := s.db.WithTx(tx)
+
+	_, err = qtx.DeleteRule(ctx, database.DeleteRuleParams{
+		UserID: user.ID,
+		ID:     matched[0].ID,
+	})
+	if err != nil {
+		return fmt.Errorf("couldn't remove rule: %w", err)
+	}
+
+	// Posts don't record which rule hid them, so the user's remaining hide
+	// rules are applied again from scratch.
+	unhidden := 0
+	if matched[0].Action == "hide" {
+		cleared, err := qtx.UnhideAllPostsForUser(ctx, user.ID)
+		if err != nil {
+			return fmt.Errorf("couldn't unhide posts: %w", err)
+		}
+		rehidden, err := hideMatchingPosts(ctx, qtx, user, uuid.NullUUID{})
+		if err != nil {
+			return err
+		}
+		unhidden = int(cleared) - rehidden
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return fmt.Errorf("couldn't commit transaction: %w", err)
+	}
+
+	fmt.Println("Rule removed:")
+	printRule(matched[0])
+	if matched[0].Action == "hide" {
+		fmt.Printf("Unhid %d posts no other rule hides.\n", unhidden)
+	}
+	return nil
+}
+
+func printRule(rule database.Rule) {
+	fmt.Printf("* %s  %-9s %s %s %q\n", rule.ID.String()[:8], rule.Action, rule.Field, rule.MatchType, rule.Pattern)
+}
+
+// loadFeedRules compiles the rules of everyone following feed. A rule that
+// no longer compiles is logged and skipped rather than failing the scrape.
+func loadFeedRules(ctx context.Context, db *database.Queries, feed database.Feed) []postRule {
+	rules, err := db.GetRulesForFeedFollowers(ctx, feed.ID)
+	if err != nil {
+		log.Printf("Couldn't get rules for feed %s: %v", feed.Name, err)
+		return nil
+	}
+
+	compiled := make([]postRule, 0, len(rules))
+	for _, rule := range rules {
+		r, err := compileRule(rule)
+		if err != nil {
+			log.Printf("Skipping rule %s: %v", rule.ID, err)
+			continue
+		}
+		compiled = append(compiled, r)
+	}
+	return compiled
+}
+
+// applyRules carries out the actions of the rules a newly inserted post
+// matches, each for the user who owns the rule.
+func applyRules(ctx context.Context, db *database.Queries, rules []postRule, feed database.Feed, post database.Post) error {
+	subject := ruleSubject{
+		Title:       post.Title,
+		Description: post.Description.String,
+		FeedName:    feed.Name,
+		FeedURL:     feed.Url,
+		Author:      post.Author.String,
+	}
+
+	for _, rule := range rules {
+		if !rule.matches(subject) {
+			continue
+		}
+
+		var err error
+		switch rule.Action {
+		case "hide":
+			err = db.HidePost(ctx, database.HidePostParams{
+				UserID: rule.UserID,
+				PostID: post.ID,
+			})
+		case "mark-read":
+			_, err = db.MarkPostRead(ctx, database.MarkPostReadParams{
+				UserID: rule.UserID,
+				PostID: post.ID,
+			})
+		case "star":
+			err = db.StarPost(ctx, database.StarPostParams{
+				UserID:    rule.UserID,
+				PostID:    post.ID,
+				CreatedAt: time.Now().UTC(),
+			})
+		case "notify":
+			err = enqueueRuleNotification(ctx, db, rule, feed, post)
+		}
+		if err != nil {
+			return fmt.Errorf("couldn't apply rule %s: %w", rule.ID, err)
+		}
+	}
+	return nil
+}
+
+// enqueueRuleNotification queues a rule.matched delivery of post to each of
+// the rule owner's webhooks that cover post's feed.
+func enqueueRuleNotification(ctx context.Context, db *database.Queries, rule postRule, feed database.Feed, post database.Post) error {
+	payload := newWebhookPayload("rule.matched", feed, post)
+	payload.Rule = &webhookRule{
+		ID:      rule.ID,
+		Field:   rule.Field,
+		Match:   rule.MatchType,
+		Pattern: rule.Pattern,
+		Action:  rule.Action,
+	}
+	dat, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("couldn't encode webhook payload: %w", err)
+	}
+
+	_, err = db.EnqueueRuleWebhookDeliveries(ctx, database.EnqueueRuleWebhookDeliveriesParams{
+		PostID:  post.ID,
+		Payload: dat,
+		UserID:  rule.UserID,
+		FeedID:  feed.ID,
+	})
+	return err
+}
+
+// hideMatchingPosts hides the posts already stored that any of user's hide
+// rules match, in every feed they follow or only in feedID. New posts are
+// hidden as they're collected, so this covers posts that arrived before a
+// rule was added or a feed was followed. It returns how many posts it hid.
+func hideMatchingPosts(ctx context.Context, db *database.Queries, user database.User, feedID uuid.NullUUID) (int, error) {
+	rules, err := db.GetRulesForUser(ctx, user.ID)
+	if err != nil {
+		return 0, fmt.Errorf("couldn't get rules: %w", err)
+	}
+
+	var hideRules []postRule
+	for _, rule := range rules {
+		if rule.Action != "hide" {
+			continue
+		}
+		compiled, err := compileRule(rule)
+		if err != nil {
+			continue
+		}
+		hideRules = append(hideRules, compiled)
+	}
+	if len(hideRules) == 0 {
+		return 0, nil
+	}
+
+	hidden := 0
+	params := database.GetUnhiddenPostsForUserParams{
+		UserID:   user.ID,
+		FeedID:   feedID,
+		MaxPosts: hideBatchSize,
+	}
+	for {
+		posts, err := db.GetUnhiddenPostsForUser(ctx, params)
+		if err != nil {
+			return hidden, fmt.Errorf("couldn't get posts: %w", err)
+		}
+		for _, post := range posts {
+			subject := ruleSubject{
+				Title:       post.Title,
+				Description: post.Description.String,
+				FeedName:    post.FeedName,
+				FeedURL:     post.FeedUrl,
+				Author:      post.Author.String,
+			}
+			if !slices.ContainsFunc(hideRules, func(rule postRule) bool { return rule.matches(subject) }) {
+				continue
+			}
+			err = db.HidePost(ctx, database.HidePostParams{
+				UserID: user.ID,
+				PostID: post.ID,
+			})
+			if err != nil {
+				return hidden, fmt.Errorf("couldn't hide post: %w", err)
+			}
+			hidden++
+		}
+		if len(posts) < hideBatchSize {
+			return hidden, nil
+		}
+		params.AfterID = posts[len(posts)-1].ID
+	}
+}
@@ -0,0 +1,290 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/VuTLy/blogAggregator/internal/database"
+	"github.com/google/uuid"
+)
+
+func TestRuleMatches(t *testing.T) {
+	subject := ruleSubject{
+		Title:       "Sponsored: Go 1.24 released",
+		Description: "<p>Generic type <b>aliases</b> &amp; more</p>",
+		FeedName:    "The Go Blog",
+		FeedURL:     "https://go.dev/blog/feed.atom",
+		Author:      "Gopher",
+	}
+	tests := []struct {
+		field, match, pattern string
+		want                  bool
+	}{
+		{"title", "substring", "sponsored", true},
+		{"title", "substring", "rust", false},
+		{"title", "word", "go", true},
+		{"title", "word", "spons", false},
+		{"title", "regex", `^Sponsored:`, true},
+		{"title", "regex", `^sponsored:`, false},
+		{"title", "regex", `(?i)^sponsored:`, true},
+		{"description", "substring", "type aliases & more", true},
+		{"description", "substring", "<b>", false},
+		{"feed", "substring", "go blog", true},
+		{"feed", "substring", "go.dev", true},
+		{"author", "word", "gopher", true},
+		{"author", "substring", "", false},
+	}
+	for _, tt := range tests {
+		rule, err := compileRule(database.Rule{Field: tt.field, MatchType: tt.match, Pattern: tt.pattern, Action: "hide"})
+		if err != nil {
+			t.Fatalf("compileRule(%s %s %q): %v", tt.field, tt.match, tt.pattern, err)
+		}
+		if got := rule.matches(subject); got != tt.want {
+			t.Errorf("%s %s %q matches = %t, want %t", tt.field, tt.match, tt.pattern, got, tt.want)
+		}
+	}
+}
+
+func TestHideRuleAppliesBeforePaging(t *testing.T) {
+	db, queries := testDB(t)
+	ctx := context.Background()
+	s := &state{db: queries}
+	user := createTestUser(t, queries, "alice")
+	feed := createTestFeed(t, queries, user, "https://example.com/feed.xml")
+	later := createTestFeed(t, queries, user, "https://example.org/feed.xml")
+	createTestFeedFollow(t, queries, user, feed)
+	for i := range 10 {
+		title := fmt.Sprintf("Post %d", i)
+		if i%2 == 0 {
+			title = "Sponsored " + title
+		}
+		createTestPost(t, queries, feed, title)
+		createTestPost(t, queries, later, title)
+	}
+
+	err := handlerRuleAdd(s, command{Name: "rule add", Args: []string{"sponsored"}}, user)
+	if err != nil {
+		t.Fatalf("rule add: %v", err)
+	}
+
+	// Every page is full of visible posts, rather than short by the hidden
+	// ones.
+	seen := 0
+	for offset := int32(0); ; offset += 2 {
+		rows, err := queries.GetFilteredPostsForUser(ctx, database.GetFilteredPostsForUserParams{
+			UserID:    user.ID,
+			MaxPosts:  2,
+			SkipPosts: offset,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, row := range rows {
+			if row.Title[0] == 'S' {
+				t.Errorf("browse shows hidden post %q", row.Title)
+			}
+		}
+		seen += len(rows)
+		if len(rows) < 2 {
+			if len(rows) != 1 {
+				t.Errorf("page at offset %d has %d posts, want 1", offset, len(rows))
+			}
+			break
+		}
+	}
+	if seen != 5 {
+		t.Errorf("browse paged through %d posts, want 5", seen)
+	}
+
+	// Feeds followed after the rule was added get the same treatment.
+	err = handlerFollow(s, command{Name: "follow", Args: []string{later.Url}}, user)
+	if err != nil {
+		t.Fatalf("follow: %v", err)
+	}
+
+	timeline, err := queries.GetPostsForUser(ctx, database.GetPostsForUserParams{UserID: user.ID, Limit: 100})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(timeline) != 10 {
+		t.Errorf("web timeline has %d posts, want 10", len(timeline))
+	}
+	feedPage, err := queries.GetPostsForFeed(ctx, database.GetPostsForFeedParams{FeedID: later.ID, Limit: 100, UserID: user.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(feedPage) != 5 {
+		t.Errorf("web feed page has %d posts, want 5", len(feedPage))
+	}
+	itemIDs, err := queries.GetReaderItemIDs(ctx, database.GetReaderItemIDsParams{UserID: user.ID, MaxItems: 100})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(itemIDs) != 10 {
+		t.Errorf("reader stream has %d items, want 10", len(itemIDs))
+	}
+	counts, err := queries.GetUnreadCountsForUser(ctx, user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, count := range counts {
+		if count.UnreadCount != 5 {
+			t.Errorf("feed %s has %d unread, want 5", count.FeedID, count.UnreadCount)
+		}
+	}
+
+	var hidden int
+	err = db.QueryRow(`SELECT COUNT(*) FROM user_post_states WHERE hidden`).Scan(&hidden)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hidden != 10 {
+		t.Errorf("%d posts hidden, want 10", hidden)
+	}
+}
+
+func TestNotifyRuleUsesWebhooksForThePostsFeed(t *testing.T) {
+	db, queries := testDB(t)
+	ctx := context.Background()
+	s := &state{db: queries}
+	user := createTestUser(t, queries, "alice")
+	feed := createTestFeed(t, queries, user, "https://example.com/feed.xml")
+	other := createTestFeed(t, queries, user, "https://example.org/feed.xml")
+	createTestFeedFollow(t, queries, user, feed)
+
+	hooks := map[string]uuid.NullUUID{
+		"https://hooks.example.com/all":   {},
+		"https://hooks.example.com/feed":  {UUID: feed.ID, Valid: true},
+		"https://hooks.example.com/other": {UUID: other.ID, Valid: true},
+	}
+	for hookURL, feedID := range hooks {
+		_, err := queries.CreateWebhook(ctx, database.CreateWebhookParams{
+			ID:        uuid.New(),
+			CreatedAt: time.Now().UTC(),
+			UserID:    user.ID,
+			FeedID:    feedID,
+			Url:       hookURL,
+			Secret:    "s3cret",
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err := handlerRuleAdd(s, command{Name: "rule add", Args: []string{"--action", "notify", "release"}}, user)
+	if err != nil {
+		t.Fatalf("rule add: %v", err)
+	}
+
+	post := createTestPost(t, queries, feed, "New release")
+	err = applyRules(ctx, queries, loadFeedRules(ctx, queries, feed), feed, post)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rows, err := db.Query(`SELECT webhooks.url FROM webhook_deliveries
+		JOIN webhooks ON webhooks.id = webhook_deliveries.webhook_id
+		WHERE webhook_deliveries.event = 'rule.matched'
+		ORDER BY webhooks.url`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	var got []string
+	for rows.Next() {
+		var hookURL string
+		if err := rows.Scan(&hookURL); err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, hookURL)
+	}
+	if want := []string{"https://hooks.example.com/all", "https://hooks.example.com/feed"}; !slices.Equal(got, want) {
+		t.Errorf("rule.matched sent to %v, want %v", got, want)
+	}
+}
+
+func TestSearchSkipsHiddenPosts(t *testing.T) {
+	_, queries := testDB(t)
+	ctx := context.Background()
+	alice := createTestUser(t, queries, "alice")
+	bob := createTestUser(t, queries, "bob")
+	feed := createTestFeed(t, queries, alice, "https://example.com/feed.xml")
+	createTestFeedFollow(t, queries, alice, feed)
+	createTestPost(t, queries, feed, "Sponsored release")
+	createTestPost(t, queries, feed, "Go release")
+
+	err := handlerRuleAdd(&state{db: queries}, command{Name: "rule add", Args: []string{"sponsored"}}, alice)
+	if err != nil {
+		t.Fatalf("rule add: %v", err)
+	}
+
+	// Hiding is per user, so bob still finds both posts.
+	for _, tt := range []struct {
+		user database.User
+		want []string
+	}{
+		{alice, []string{"Go release"}},
+		{bob, []string{"Go release", "Sponsored release"}},
+	} {
+		results, err := queries.SearchPosts(ctx, database.SearchPostsParams{
+			Query:      "release",
+			ViewerID:   tt.user.ID,
+			MaxResults: 10,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, result := range results {
+			got = append(got, result.Title)
+		}
+		slices.Sort(got)
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("%s's search found %v, want %v", tt.user.Name, got, tt.want)
+		}
+	}
+}
+
+func TestRuleRemoveUnhidesPosts(t *testing.T) {
+	db, queries := testDB(t)
+	ctx := context.Background()
+	s := &state{db: queries, conn: db}
+	user := createTestUser(t, queries, "alice")
+	feed := createTestFeed(t, queries, user, "https://example.com/feed.xml")
+	createTestFeedFollow(t, queries, user, feed)
+	for _, title := range []string{"Sponsored post", "Ad break", "Sponsored ad", "Plain post"} {
+		createTestPost(t, queries, feed, title)
+	}
+
+	for _, pattern := range []string{"sponsored", "ad"} {
+		err := handlerRuleAdd(s, command{Name: "rule add", Args: []string{"--match", "word", pattern}}, user)
+		if err != nil {
+			t.Fatalf("rule add %s: %v", pattern, err)
+		}
+	}
+	rules, err := queries.GetRulesForUser(ctx, user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	i := slices.IndexFunc(rules, func(rule database.Rule) bool { return rule.Pattern == "sponsored" })
+	err = handlerRuleRemove(s, command{Name: "rule rm", Args: []string{rules[i].ID.String()}}, user)
+	if err != nil {
+		t.Fatalf("rule rm: %v", err)
+	}
+
+	// Only the post that no remaining rule matches comes back.
+	rows, err := queries.GetPostsForUser(ctx, database.GetPostsForUserParams{UserID: user.ID, Limit: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, row := range rows {
+		got = append(got, row.Title)
+	}
+	slices.Sort(got)
+	if want := []string{"Plain post", "Sponsored post"}; !slices.Equal(got, want) {
+		t.Errorf("after removing the sponsored rule, timeline has %v, want %v", got, want)
+	}
+}
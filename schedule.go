@@ -0,0 +1,111 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/VuTLy/blogAggregator/internal/database"
+)
+
+const (
+	minFetchInterval  = 15 * time.Minute
+	maxFetchInterval  = 24 * time.Hour
+	maxFailureBackoff = 48 * time.Hour
+)
+
+// nextFetchInterval adapts a feed's polling interval to how often it posts.
+// The feed is polled about twice per typical gap between its recent posts,
+// blended with the previous interval so one burst of posts doesn't swing the
+// schedule, and never more often than the channel's ttl allows.
+func nextFetchInterval(feed *RSSFeed, previous time.Duration) time.Duration {
+	interval := previous
+	if gap, ok := typicalPostGap(feed.Channel.Item); ok {
+		interval = (previous + gap/2) / 2
+	}
+
+	if ttl, err := strconv.Atoi(strings.TrimSpace(feed.Channel.TTL)); err == nil && ttl > 0 {
+		interval = max(interval, time.Duration(ttl)*time.Minute)
+	}
+
+	return min(max(interval, minFetchInterval), maxFetchInterval)
+}
+
+// typicalPostGap returns the median time between the most recent dated
+// items.
+func typicalPostGap(items []RSSItem) (time.Duration, bool) {
+	const sampleSize = 10
+
+	var dates []time.Time
+	for _, item := range items {
+		if t, ok := itemDate(item); ok {
+			dates = append(dates, t)
+		}
+	}
+	if len(dates) < 2 {
+		return 0, false
+	}
+
+	slices.SortFunc(dates, func(a, b time.Time) int {
+		return b.Compare(a)
+	})
+	if len(dates) > sampleSize {
+		dates = dates[:sampleSize]
+	}
+
+	gaps := make([]time.Duration, 0, len(dates)-1)
+	for i := 1; i < len(dates); i++ {
+		gaps = append(gaps, dates[i-1].Sub(dates[i]))
+	}
+	slices.Sort(gaps)
+	return gaps[len(gaps)/2], true
+}
+
+// nextFetchTime returns the first time at least interval after from that
+// isn't excluded by the channel's skipHours or skipDays, which are in GMT.
+func nextFetchTime(feed *RSSFeed, from time.Time, interval time.Duration) time.Time {
+	skipHours := map[int]bool{}
+	for _, hour := range feed.Channel.SkipHours {
+		if h, err := strconv.Atoi(strings.TrimSpace(hour)); err == nil {
+			skipHours[h%24] = true
+		}
+	}
+	skipDays := map[string]bool{}
+	for _, day := range feed.Channel.SkipDays {
+		skipDays[strings.ToLower(strings.TrimSpace(day))] = true
+	}
+
+	next := from.Add(interval).UTC()
+	// Bound the search to a week so a feed that skips every hour is still
+	// fetched eventually.
+	for range 7 * 24 {
+		if !skipHours[next.Hour()] && !skipDays[strings.ToLower(next.Weekday().String())] {
+			break
+		}
+		next = next.Truncate(time.Hour).Add(time.Hour)
+	}
+	return next
+}
+
+// failureBackoff doubles a feed's interval for each consecutive failure, up
+// to maxFailureBackoff, and waits at least as long as a 429 or 503 response
+// asked with Retry-After, though never longer than maxFailureBackoff.
+func failureBackoff(feed database.Feed, err error) time.Duration {
+	backoff := max(time.Duration(feed.FetchIntervalSeconds)*time.Second, minFetchInterval)
+	for i := int32(0); i <= feed.ConsecutiveFailures && backoff < maxFailureBackoff; i++ {
+		backoff *= 2
+	}
+	backoff = min(backoff, maxFailureBackoff)
+
+	var statusErr *httpStatusError
+	if errors.As(err, &statusErr) {
+		switch statusErr.StatusCode {
+		case http.StatusTooManyRequests, http.StatusServiceUnavailable:
+			backoff = max(backoff, min(statusErr.RetryAfter, maxFailureBackoff))
+		}
+	}
+	return backoff
+}
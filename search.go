@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"strings"
+	"unicode"
+
+	"github.com/VuTLy/blogAggregator/internal/database"
+	"github.com/google/uuid"
+)
+
+func handlerSearch(s *state, cmd command, user database.User) error {
+	fs := flag.NewFlagSet(cmd.Name, flag.ContinueOnError)
+	mine := fs.Bool("mine", false, "only search feeds you follow")
+	limit := fs.Int("limit", 10, "maximum number of results")
+	args, err := parseFlags(fs, cmd.Args)
+	if err != nil {
+		return err
+	}
+	if len(args) == 0 {
+		return fmt.Errorf(`usage: %s <query> [--mine] [--limit n]  (use "quoted phrases" and prefix*)`, cmd.Name)
+	}
+
+	query, err := buildTSQuery(strings.Join(args, " "))
+	if err != nil {
+		return err
+	}
+
+	userID := uuid.NullUUID{}
+	if *mine {
+		userID = uuid.NullUUID{
+			UUID:  user.ID,
+			Valid: true,
+		}
+	}
+
+	results, err := s.db.SearchPosts(context.Background(), database.SearchPostsParams{
+		Query:      query,
+		UserID:     userID,
+		ViewerID:   user.ID,
+		MaxResults: int32(*limit),
+	})
+	if err != nil {
+		return fmt.Errorf("couldn't search posts: %w", err)
+	}
+
+	fmt.Printf("Found %d posts matching %s:\n", len(results), strings.Join(args, " "))
+	for _, result := range results {
+		fmt.Printf("%s from %s (rank %.3f)\n", result.PublishedAt.Time.Format("Mon Jan 2 2006"), result.FeedName, result.Rank)
+		fmt.Printf("--- %s ---\n", result.Title)
+		fmt.Printf("    %s\n", result.Headline)
+		fmt.Printf("Link: %s\n", result.Url)
+		fmt.Printf("ID:   %s\n", result.ID)
+		fmt.Println("=====================================")
+	}
+
+	return nil
+}
+
+// buildTSQuery converts a search string into to_tsquery syntax. Words must
+// all match, "quoted phrases" must match in order, and a trailing * makes a
+// word match as a prefix. Punctuation is dropped, so user input can never
+// produce a tsquery syntax error.
+func buildTSQuery(search string) (string, error) {
+	var terms []string
+	for i, part := range strings.Split(search, `"`) {
+		if i%2 == 1 {
+			// Inside quotes: a phrase.
+			words := tsWords(part)
+			for j, word := range words {
+				words[j] = tsLexeme(word, false)
+			}
+			if len(words) > 0 {
+				terms = append(terms, "("+strings.Join(words, " <-> ")+")")
+			}
+			continue
+		}
+
+		for _, field := range strings.Fields(part) {
+			words := tsWords(field)
+			for j, word := range words {
+				prefix := j == len(words)-1 && strings.HasSuffix(field, "*")
+				terms = append(terms, tsLexeme(word, prefix))
+			}
+		}
+	}
+
+	if len(terms) == 0 {
+		return "", errors.New("search query has no words in it")
+	}
+	return strings.Join(terms, " & "), nil
+}
+
+func tsWords(s string) []string {
+	return strings.FieldsFunc(s, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+func tsLexeme(word string, prefix bool) string {
+	lexeme := "'" + strings.ToLower(word) + "'"
+	if prefix {
+		lexeme += ":*"
+	}
+	return lexeme
+}
@@ -0,0 +1,26 @@
+-- name: CreateAPIKey :one
+INSERT INTO api_keys (id, created_at, user_id, name, prefix, key_hash)
+VALUES ($1, $2, $3, $4, $5, $6)
+RETURNING *;
+
+-- name: GetUserByAPIKey :one
+WITH used_key AS (
+    UPDATE api_keys
+    SET last_used_at = NOW()
+    WHERE key_hash = $1 AND revoked_at IS NULL
+    RETURNING user_id
+)
+SELECT users.* FROM users
+JOIN used_key ON used_key.user_id = users.id;
+
+-- name: GetAPIKeysForUser :many
+SELECT * FROM api_keys
+WHERE user_id = $1
+ORDER BY created_at;
+
+-- name: RevokeAPIKey :execrows
+UPDATE api_keys
+SET revoked_at = NOW()
+WHERE user_id = @user_id
+AND (prefix = @key OR name = @key)
+AND revoked_at IS NULL;
@@ -0,0 +1,63 @@
+-- name: UpsertDigestSubscription :one
+INSERT INTO digest_subscriptions (user_id, created_at, updated_at, email, frequency)
+VALUES ($1, $2, $3, $4, $5)
+ON CONFLICT (user_id) DO UPDATE
+SET email = EXCLUDED.email,
+frequency = EXCLUDED.frequency,
+updated_at = EXCLUDED.updated_at
+RETURNING *;
+
+-- name: DeleteDigestSubscription :execrows
+DELETE FROM digest_subscriptions
+WHERE user_id = $1;
+
+-- name: GetDigestSubscription :one
+SELECT digest_subscriptions.*, latest.window_end AS last_window_end FROM digest_subscriptions
+LEFT JOIN digests latest ON latest.user_id = digest_subscriptions.user_id
+AND NOT EXISTS (
+    SELECT 1 FROM digests newer
+    WHERE newer.user_id = latest.user_id
+    AND (newer.window_end, newer.id) > (latest.window_end, latest.id)
+)
+WHERE digest_subscriptions.user_id = $1;
+
+-- name: GetDueDigestSubscriptions :many
+SELECT digest_subscriptions.*, latest.window_end AS last_window_end, users.name AS user_name FROM digest_subscriptions
+JOIN users ON users.id = digest_subscriptions.user_id
+LEFT JOIN digests latest ON latest.user_id = digest_subscriptions.user_id
+AND NOT EXISTS (
+    SELECT 1 FROM digests newer
+    WHERE newer.user_id = latest.user_id
+    AND (newer.window_end, newer.id) > (latest.window_end, latest.id)
+)
+WHERE latest.window_end IS NULL
+OR latest.window_end <= NOW() - CASE digest_subscriptions.frequency
+    WHEN 'weekly' THEN INTERVAL '7 days'
+    ELSE INTERVAL '1 day'
+END
+ORDER BY digest_subscriptions.created_at;
+
+-- name: GetDigestPosts :many
+SELECT posts.*, feeds.name AS feed_name, feeds.url AS feed_url FROM posts
+JOIN feed_follows ON feed_follows.feed_id = posts.feed_id
+JOIN feeds ON feeds.id = posts.feed_id
+LEFT JOIN user_post_states ON user_post_states.post_id = posts.id
+    AND user_post_states.user_id = feed_follows.user_id
+WHERE feed_follows.user_id = @user_id
+AND posts.created_at > @window_start
+AND posts.created_at <= @window_end
+AND user_post_states.read IS NOT TRUE
+AND user_post_states.hidden IS NOT TRUE
+ORDER BY posts.created_at, posts.id
+LIMIT @max_posts;
+
+-- name: CreateDigest :one
+INSERT INTO digests (id, sent_at, user_id, email, window_start, window_end, post_count)
+VALUES ($1, $2, $3, $4, $5, $6, $7)
+RETURNING *;
+
+-- name: GetDigestsForUser :many
+SELECT * FROM digests
+WHERE user_id = $1
+ORDER BY window_end DESC
+LIMIT $2;
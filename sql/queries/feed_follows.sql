@@ -14,13 +14,20 @@ INNER JOIN users ON inserted_feed_follow.user_id = users.id;
 --
 
 -- name: GetFeedFollowsForUser :many
-SELECT feed_follows.*, feeds.name AS feed_name, users.name AS user_name
+SELECT feed_follows.*, feeds.name AS feed_name, feeds.url AS feed_url, users.name AS user_name
 FROM feed_follows
 INNER JOIN feeds ON feed_follows.feed_id = feeds.id
 INNER JOIN users ON feed_follows.user_id = users.id
 WHERE feed_follows.user_id = $1;
 --
 
--- name: DeleteFeedFollow :exec
+-- name: DeleteFeedFollow :execrows
 DELETE FROM feed_follows WHERE feed_id = $1 AND user_id = $2;
 --
+
+-- name: SetFeedFollowCategory :exec
+UPDATE feed_follows
+SET category = $3,
+updated_at = NOW()
+WHERE user_id = $1 AND feed_id = $2;
+--
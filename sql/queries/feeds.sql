@@ -1,6 +1,6 @@
 -- name: CreateFeed :one
-INSERT INTO feeds (id, created_at, updated_at, name, url, user_id)
-VALUES ($1, $2, $3, $4, $5, $6)
+INSERT INTO feeds (id, created_at, updated_at, name, url, user_id, public_only)
+VALUES ($1, $2, $3, $4, $5, $6, $7)
 RETURNING *;
 
 -- name: GetFeeds :many
@@ -10,14 +10,86 @@ SELECT * FROM feeds;
 SELECT * FROM feeds
 WHERE url = $1;
 
--- name: GetNextFeedToFetch :one
+-- name: GetFeedByID :one
 SELECT * FROM feeds
-ORDER BY last_fetched_at ASC NULLS FIRST
-LIMIT 1;
+WHERE id = $1;
 
--- name: MarkFeedFetched :one
+-- name: ListFeeds :many
+SELECT * FROM feeds
+ORDER BY created_at, id
+LIMIT $1 OFFSET $2;
+
+-- name: ClaimFeedsToFetch :many
 UPDATE feeds
 SET last_fetched_at = NOW(),
+next_fetch_at = NOW() + fetch_interval_seconds * INTERVAL '1 second',
+updated_at = NOW()
+WHERE id IN (
+    SELECT id FROM feeds
+    WHERE disabled_at IS NULL
+    AND (next_fetch_at IS NULL OR next_fetch_at <= NOW())
+    ORDER BY next_fetch_at ASC NULLS FIRST
+    LIMIT @max_feeds
+    FOR UPDATE SKIP LOCKED
+)
+RETURNING *;
+
+-- name: ReleaseFeedClaim :exec
+UPDATE feeds
+SET next_fetch_at = NOW(),
+updated_at = NOW()
+WHERE id = $1;
+
+-- name: UpdateFeedValidators :exec
+UPDATE feeds
+SET etag = $2,
+last_modified = $3,
+updated_at = NOW()
+WHERE id = $1;
+
+-- name: UpdateFeedSchedule :exec
+UPDATE feeds
+SET next_fetch_at = NOW() + sqlc.arg(delay_seconds)::int * INTERVAL '1 second',
+fetch_interval_seconds = sqlc.arg(fetch_interval_seconds),
+updated_at = NOW()
+WHERE id = sqlc.arg(id);
+
+-- name: MarkFeedSucceeded :exec
+UPDATE feeds
+SET last_error = NULL,
+consecutive_failures = 0,
+last_success_at = NOW(),
+updated_at = NOW()
+WHERE id = $1;
+
+-- name: MarkFeedFailed :one
+UPDATE feeds
+SET last_error = sqlc.arg(last_error),
+consecutive_failures = consecutive_failures + 1,
+next_fetch_at = NOW() + sqlc.arg(delay_seconds)::int * INTERVAL '1 second',
+disabled_at = CASE
+    WHEN sqlc.arg(max_failures)::int > 0 AND consecutive_failures + 1 >= sqlc.arg(max_failures)::int THEN NOW()
+    ELSE disabled_at
+END,
+updated_at = NOW()
+WHERE id = sqlc.arg(id)
+RETURNING *;
+
+-- name: EnableFeed :one
+UPDATE feeds
+SET disabled_at = NULL,
+consecutive_failures = 0,
+next_fetch_at = NULL,
+updated_at = NOW()
+WHERE url = $1
+RETURNING *;
+
+-- name: SetFeedRetention :one
+UPDATE feeds
+SET max_post_age_seconds = CASE WHEN @set_max_age::bool
+    THEN sqlc.narg(max_post_age_seconds)::int ELSE max_post_age_seconds END,
+max_posts = CASE WHEN @set_max_posts::bool
+    THEN sqlc.narg(max_posts)::int ELSE max_posts END,
 updated_at = NOW()
-WHERE id = $1
+WHERE url = @url
 RETURNING *;
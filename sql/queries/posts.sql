@@ -1,14 +1,201 @@
--- name: CreatePost :one
-INSERT INTO posts (id, created_at, updated_at, title, url, description, published_at, feed_id)
-VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+-- name: UpsertPost :one
+INSERT INTO posts (id, created_at, updated_at, title, url, description, published_at, feed_id, guid, author)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+ON CONFLICT (feed_id, guid) DO UPDATE
+SET title = EXCLUDED.title,
+url = EXCLUDED.url,
+description = EXCLUDED.description,
+author = EXCLUDED.author,
+updated_at = EXCLUDED.updated_at
+WHERE posts.title IS DISTINCT FROM EXCLUDED.title
+OR posts.url IS DISTINCT FROM EXCLUDED.url
+OR posts.description IS DISTINCT FROM EXCLUDED.description
+OR posts.author IS DISTINCT FROM EXCLUDED.author
 RETURNING *;
 --
 
+-- name: RekeyLegacyPost :execrows
+UPDATE posts
+SET guid = @guid
+WHERE posts.feed_id = @feed_id
+AND posts.url = @url
+AND posts.guid = posts.url
+AND NOT EXISTS (
+    SELECT 1 FROM posts AS keyed
+    WHERE keyed.feed_id = @feed_id
+    AND keyed.guid = @guid
+);
+--
+
 -- name: GetPostsForUser :many
-SELECT posts.*, feeds.name AS feed_name FROM posts
+SELECT posts.*, feeds.name AS feed_name, feeds.url AS feed_url FROM posts
 JOIN feed_follows ON feed_follows.feed_id = posts.feed_id
 JOIN feeds ON posts.feed_id = feeds.id
+LEFT JOIN user_post_states ON user_post_states.post_id = posts.id
+    AND user_post_states.user_id = feed_follows.user_id
 WHERE feed_follows.user_id = $1
+AND user_post_states.hidden IS NOT TRUE
 ORDER BY posts.published_at DESC
 LIMIT $2;
 --
+
+-- name: GetPostsForFeed :many
+SELECT posts.*, feeds.name AS feed_name, feeds.url AS feed_url FROM posts
+JOIN feeds ON posts.feed_id = feeds.id
+WHERE posts.feed_id = $1
+AND NOT EXISTS (
+    SELECT 1 FROM user_post_states
+    WHERE user_post_states.post_id = posts.id
+    AND user_post_states.user_id = $3
+    AND user_post_states.hidden
+)
+ORDER BY posts.published_at DESC
+LIMIT $2;
+--
+
+-- name: SearchPosts :many
+SELECT
+    posts.id,
+    posts.title,
+    posts.url,
+    posts.published_at,
+    feeds.name AS feed_name,
+    ts_rank(posts.search, query) AS rank,
+    ts_headline(
+        'english',
+        coalesce(posts.description, posts.title),
+        query,
+        'MaxFragments=2, MinWords=5, MaxWords=20, StartSel=**, StopSel=**'
+    )::text AS headline
+FROM posts
+JOIN feeds ON posts.feed_id = feeds.id,
+to_tsquery('english', @query) query
+WHERE posts.search @@ query
+AND (sqlc.narg(user_id)::uuid IS NULL OR posts.feed_id IN (
+    SELECT feed_follows.feed_id FROM feed_follows
+    WHERE feed_follows.user_id = sqlc.narg(user_id)::uuid
+))
+AND NOT EXISTS (
+    SELECT 1 FROM user_post_states
+    WHERE user_post_states.post_id = posts.id
+    AND user_post_states.user_id = @viewer_id::uuid
+    AND user_post_states.hidden
+)
+ORDER BY rank DESC, posts.published_at DESC
+LIMIT @max_results;
+--
+
+-- name: GetFilteredPostsForUser :many
+SELECT posts.*, feeds.name AS feed_name, feeds.url AS feed_url FROM posts
+JOIN feed_follows ON feed_follows.feed_id = posts.feed_id
+JOIN feeds ON posts.feed_id = feeds.id
+LEFT JOIN user_post_states ON user_post_states.post_id = posts.id
+    AND user_post_states.user_id = feed_follows.user_id
+WHERE feed_follows.user_id = @user_id
+AND (@include_read::bool OR user_post_states.read IS NOT TRUE)
+AND (@include_hidden::bool OR user_post_states.hidden IS NOT TRUE)
+AND (sqlc.narg(feed_id)::uuid IS NULL OR posts.feed_id = sqlc.narg(feed_id)::uuid)
+AND (sqlc.narg(since)::timestamp IS NULL OR posts.published_at >= sqlc.narg(since)::timestamp)
+AND (sqlc.narg(until)::timestamp IS NULL OR posts.published_at < sqlc.narg(until)::timestamp)
+ORDER BY
+    CASE WHEN @oldest_first::bool THEN posts.published_at END ASC,
+    CASE WHEN NOT @oldest_first::bool THEN posts.published_at END DESC,
+    posts.id
+LIMIT sqlc.arg(max_posts)
+OFFSET sqlc.arg(skip_posts);
+--
+
+-- name: CountPrunablePosts :many
+WITH ranked AS (
+    SELECT
+        posts.id,
+        posts.feed_id,
+        posts.published_at,
+        ROW_NUMBER() OVER (
+            PARTITION BY posts.feed_id
+            ORDER BY posts.published_at DESC NULLS LAST, posts.created_at DESC
+        ) AS position
+    FROM posts
+),
+prunable AS (
+    SELECT ranked.id, ranked.feed_id FROM ranked
+    JOIN feeds ON ranked.feed_id = feeds.id
+    WHERE (
+        (
+            COALESCE(feeds.max_post_age_seconds, @default_max_age_seconds::int) > 0
+            AND ranked.published_at < (NOW() AT TIME ZONE 'UTC')
+                - COALESCE(feeds.max_post_age_seconds, @default_max_age_seconds::int) * INTERVAL '1 second'
+        )
+        OR (
+            feeds.max_posts IS NOT NULL
+            AND ranked.position > feeds.max_posts
+            AND NOT EXISTS (
+                SELECT 1 FROM feed_follows
+                LEFT JOIN user_post_states ON user_post_states.post_id = ranked.id
+                    AND user_post_states.user_id = feed_follows.user_id
+                WHERE feed_follows.feed_id = ranked.feed_id
+                AND user_post_states.read IS NOT TRUE
+                AND user_post_states.hidden IS NOT TRUE
+            )
+        )
+    )
+    AND NOT EXISTS (
+        SELECT 1 FROM user_post_stars
+        WHERE user_post_stars.post_id = ranked.id
+    )
+)
+SELECT feeds.name AS feed_name, feeds.url AS feed_url, COUNT(*) AS post_count FROM prunable
+JOIN feeds ON prunable.feed_id = feeds.id
+GROUP BY feeds.id
+ORDER BY feeds.name, feeds.url;
+--
+
+-- name: DeletePrunablePosts :many
+WITH ranked AS (
+    SELECT
+        posts.id,
+        posts.feed_id,
+        posts.published_at,
+        ROW_NUMBER() OVER (
+            PARTITION BY posts.feed_id
+            ORDER BY posts.published_at DESC NULLS LAST, posts.created_at DESC
+        ) AS position
+    FROM posts
+),
+prunable AS (
+    SELECT ranked.id, ranked.feed_id FROM ranked
+    JOIN feeds ON ranked.feed_id = feeds.id
+    WHERE (
+        (
+            COALESCE(feeds.max_post_age_seconds, @default_max_age_seconds::int) > 0
+            AND ranked.published_at < (NOW() AT TIME ZONE 'UTC')
+                - COALESCE(feeds.max_post_age_seconds, @default_max_age_seconds::int) * INTERVAL '1 second'
+        )
+        OR (
+            feeds.max_posts IS NOT NULL
+            AND ranked.position > feeds.max_posts
+            AND NOT EXISTS (
+                SELECT 1 FROM feed_follows
+                LEFT JOIN user_post_states ON user_post_states.post_id = ranked.id
+                    AND user_post_states.user_id = feed_follows.user_id
+                WHERE feed_follows.feed_id = ranked.feed_id
+                AND user_post_states.read IS NOT TRUE
+                AND user_post_states.hidden IS NOT TRUE
+            )
+        )
+    )
+    AND NOT EXISTS (
+        SELECT 1 FROM user_post_stars
+        WHERE user_post_stars.post_id = ranked.id
+    )
+),
+deleted AS (
+    DELETE FROM posts
+    WHERE posts.id IN (SELECT prunable.id FROM prunable)
+    RETURNING posts.feed_id
+)
+SELECT feeds.name AS feed_name, feeds.url AS feed_url, COUNT(*) AS post_count FROM deleted
+JOIN feeds ON deleted.feed_id = feeds.id
+GROUP BY feeds.id
+ORDER BY feeds.name, feeds.url;
+--
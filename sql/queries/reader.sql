@@ -0,0 +1,41 @@
+-- name: GetReaderItemIDs :many
+SELECT posts.item_id, posts.published_at FROM posts
+JOIN feed_follows ON feed_follows.feed_id = posts.feed_id
+LEFT JOIN user_post_states ON user_post_states.post_id = posts.id
+    AND user_post_states.user_id = feed_follows.user_id
+LEFT JOIN user_post_stars ON user_post_stars.post_id = posts.id
+    AND user_post_stars.user_id = feed_follows.user_id
+WHERE feed_follows.user_id = @user_id
+AND (sqlc.narg(feed_id)::uuid IS NULL OR posts.feed_id = sqlc.narg(feed_id)::uuid)
+AND (sqlc.narg(category)::text IS NULL OR feed_follows.category = sqlc.narg(category)::text)
+AND (NOT @starred_only::bool OR user_post_stars.post_id IS NOT NULL)
+AND (NOT @read_only::bool OR user_post_states.read IS TRUE)
+AND (NOT @exclude_read::bool OR user_post_states.read IS NOT TRUE)
+AND user_post_states.hidden IS NOT TRUE
+AND (sqlc.narg(since)::timestamp IS NULL OR posts.published_at >= sqlc.narg(since)::timestamp)
+AND (sqlc.narg(until)::timestamp IS NULL OR posts.published_at < sqlc.narg(until)::timestamp)
+ORDER BY
+    CASE WHEN @oldest_first::bool THEN posts.published_at END ASC,
+    CASE WHEN NOT @oldest_first::bool THEN posts.published_at END DESC,
+    posts.item_id
+LIMIT sqlc.arg(max_items)
+OFFSET sqlc.arg(skip_items);
+
+-- name: GetReaderItems :many
+SELECT
+    posts.*,
+    feeds.name AS feed_name,
+    feeds.url AS feed_url,
+    feed_follows.category,
+    COALESCE(user_post_states.read, FALSE)::bool AS read,
+    (user_post_stars.post_id IS NOT NULL)::bool AS starred
+FROM posts
+JOIN feeds ON posts.feed_id = feeds.id
+JOIN feed_follows ON feed_follows.feed_id = posts.feed_id
+    AND feed_follows.user_id = @user_id
+LEFT JOIN user_post_states ON user_post_states.post_id = posts.id
+    AND user_post_states.user_id = @user_id
+LEFT JOIN user_post_stars ON user_post_stars.post_id = posts.id
+    AND user_post_stars.user_id = @user_id
+WHERE posts.item_id = ANY(@item_ids::bigint[])
+ORDER BY posts.published_at DESC, posts.item_id;
@@ -0,0 +1,32 @@
+-- name: CreateRule :one
+INSERT INTO rules (id, created_at, user_id, field, match_type, pattern, action)
+VALUES ($1, $2, $3, $4, $5, $6, $7)
+RETURNING *;
+
+-- name: GetRulesForUser :many
+SELECT * FROM rules
+WHERE user_id = $1
+ORDER BY created_at;
+
+-- name: GetRulesForFeedFollowers :many
+SELECT rules.* FROM rules
+JOIN feed_follows ON feed_follows.user_id = rules.user_id
+WHERE feed_follows.feed_id = $1
+ORDER BY rules.user_id, rules.created_at;
+
+-- name: DeleteRule :execrows
+DELETE FROM rules
+WHERE user_id = $1 AND id = $2;
+
+-- name: GetUnhiddenPostsForUser :many
+SELECT posts.id, posts.title, posts.description, posts.author, feeds.name AS feed_name, feeds.url AS feed_url FROM posts
+JOIN feed_follows ON feed_follows.feed_id = posts.feed_id
+JOIN feeds ON feeds.id = posts.feed_id
+LEFT JOIN user_post_states ON user_post_states.post_id = posts.id
+    AND user_post_states.user_id = feed_follows.user_id
+WHERE feed_follows.user_id = @user_id
+AND (sqlc.narg(feed_id)::uuid IS NULL OR posts.feed_id = sqlc.narg(feed_id)::uuid)
+AND posts.id > @after_id
+AND user_post_states.hidden IS NOT TRUE
+ORDER BY posts.id
+LIMIT @max_posts;
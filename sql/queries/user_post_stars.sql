@@ -0,0 +1,16 @@
+-- name: StarPost :exec
+INSERT INTO user_post_stars (user_id, post_id, created_at)
+VALUES ($1, $2, $3)
+ON CONFLICT (user_id, post_id) DO NOTHING;
+
+-- name: UnstarPost :execrows
+DELETE FROM user_post_stars
+WHERE user_id = $1 AND post_id = $2;
+
+-- name: GetStarredPostsForUser :many
+SELECT posts.*, feeds.name AS feed_name, feeds.url AS feed_url FROM user_post_stars
+JOIN posts ON user_post_stars.post_id = posts.id
+JOIN feeds ON posts.feed_id = feeds.id
+WHERE user_post_stars.user_id = $1
+ORDER BY user_post_stars.created_at DESC
+LIMIT $2;
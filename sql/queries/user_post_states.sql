@@ -0,0 +1,73 @@
+-- name: MarkPostRead :execrows
+INSERT INTO user_post_states (user_id, post_id, read, read_at)
+VALUES ($1, $2, TRUE, NOW())
+ON CONFLICT (user_id, post_id) DO UPDATE
+SET read = TRUE,
+read_at = NOW()
+WHERE user_post_states.read = FALSE;
+
+-- name: MarkPostUnread :execrows
+UPDATE user_post_states
+SET read = FALSE,
+read_at = NULL
+WHERE user_id = $1 AND post_id = $2 AND read = TRUE;
+
+-- name: MarkAllPostsRead :execrows
+INSERT INTO user_post_states (user_id, post_id, read, read_at)
+SELECT feed_follows.user_id, posts.id, TRUE, NOW() FROM posts
+JOIN feed_follows ON feed_follows.feed_id = posts.feed_id
+WHERE feed_follows.user_id = @user_id
+AND (sqlc.narg(created_before)::timestamp IS NULL OR posts.created_at <= sqlc.narg(created_before)::timestamp)
+ON CONFLICT (user_id, post_id) DO UPDATE
+SET read = TRUE,
+read_at = NOW()
+WHERE user_post_states.read = FALSE;
+
+-- name: MarkAllPostsUnread :execrows
+UPDATE user_post_states
+SET read = FALSE,
+read_at = NULL
+WHERE user_id = $1 AND read = TRUE;
+
+-- name: MarkFeedPostsRead :execrows
+INSERT INTO user_post_states (user_id, post_id, read, read_at)
+SELECT feed_follows.user_id, posts.id, TRUE, NOW() FROM posts
+JOIN feed_follows ON feed_follows.feed_id = posts.feed_id
+WHERE feed_follows.user_id = @user_id
+AND posts.feed_id = @feed_id
+AND (sqlc.narg(created_before)::timestamp IS NULL OR posts.created_at <= sqlc.narg(created_before)::timestamp)
+ON CONFLICT (user_id, post_id) DO UPDATE
+SET read = TRUE,
+read_at = NOW()
+WHERE user_post_states.read = FALSE;
+
+-- name: MarkFeedPostsUnread :execrows
+UPDATE user_post_states
+SET read = FALSE,
+read_at = NULL
+FROM posts
+WHERE user_post_states.post_id = posts.id
+AND user_post_states.user_id = $1
+AND posts.feed_id = $2
+AND user_post_states.read = TRUE;
+
+-- name: GetUnreadCountsForUser :many
+SELECT posts.feed_id, COUNT(*) AS unread_count FROM posts
+JOIN feed_follows ON feed_follows.feed_id = posts.feed_id
+LEFT JOIN user_post_states ON user_post_states.post_id = posts.id
+    AND user_post_states.user_id = feed_follows.user_id
+WHERE feed_follows.user_id = $1
+AND user_post_states.read IS NOT TRUE
+AND user_post_states.hidden IS NOT TRUE
+GROUP BY posts.feed_id;
+
+-- name: HidePost :exec
+INSERT INTO user_post_states (user_id, post_id, hidden)
+VALUES ($1, $2, TRUE)
+ON CONFLICT (user_id, post_id) DO UPDATE
+SET hidden = TRUE;
+
+-- name: UnhideAllPostsForUser :execrows
+UPDATE user_post_states
+SET hidden = FALSE
+WHERE user_id = $1 AND hidden;
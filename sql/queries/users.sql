@@ -19,3 +19,8 @@ SELECT * FROM users;
 
 -- name: GetUserById :one
 SELECT * FROM users WHERE id = $1;
+
+-- name: ListUsers :many
+SELECT * FROM users
+ORDER BY created_at, id
+LIMIT $1 OFFSET $2;
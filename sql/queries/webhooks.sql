@@ -0,0 +1,91 @@
+-- name: CreateWebhook :one
+INSERT INTO webhooks (id, created_at, user_id, feed_id, url, secret)
+VALUES ($1, $2, $3, $4, $5, $6)
+RETURNING *;
+
+-- name: GetWebhooksForUser :many
+SELECT webhooks.*, feeds.url AS feed_url FROM webhooks
+LEFT JOIN feeds ON feeds.id = webhooks.feed_id
+WHERE webhooks.user_id = $1
+ORDER BY webhooks.created_at;
+
+-- name: DeleteWebhook :execrows
+DELETE FROM webhooks
+WHERE user_id = @user_id
+AND (id::text = sqlc.arg(webhook)::text OR url = sqlc.arg(webhook)::text);
+
+-- name: EnqueueWebhookDeliveries :execrows
+INSERT INTO webhook_deliveries (id, created_at, webhook_id, post_id, payload, next_attempt_at)
+SELECT gen_random_uuid(), NOW(), webhooks.id, @post_id::uuid, @payload::jsonb, NOW()
+FROM webhooks
+WHERE webhooks.feed_id = @feed_id::uuid
+OR (webhooks.feed_id IS NULL AND EXISTS (
+    SELECT 1 FROM feed_follows
+    WHERE feed_follows.user_id = webhooks.user_id
+    AND feed_follows.feed_id = @feed_id::uuid
+))
+ON CONFLICT (webhook_id, post_id, event) DO NOTHING;
+
+-- name: EnqueueRuleWebhookDeliveries :execrows
+INSERT INTO webhook_deliveries (id, created_at, webhook_id, post_id, event, payload, next_attempt_at)
+SELECT gen_random_uuid(), NOW(), webhooks.id, @post_id::uuid, 'rule.matched', @payload::jsonb, NOW()
+FROM webhooks
+WHERE webhooks.user_id = @user_id::uuid
+AND (webhooks.feed_id IS NULL OR webhooks.feed_id = @feed_id::uuid)
+ON CONFLICT (webhook_id, post_id, event) DO NOTHING;
+
+-- name: ClaimWebhookDeliveries :many
+UPDATE webhook_deliveries
+SET attempts = webhook_deliveries.attempts + 1,
+next_attempt_at = NOW() + sqlc.arg(lease_seconds)::int * INTERVAL '1 second'
+FROM webhooks
+WHERE webhooks.id = webhook_deliveries.webhook_id
+AND webhook_deliveries.id IN (
+    SELECT id FROM webhook_deliveries
+    WHERE delivered_at IS NULL
+    AND failed_at IS NULL
+    AND next_attempt_at <= NOW()
+    ORDER BY next_attempt_at
+    LIMIT @max_deliveries
+    FOR UPDATE SKIP LOCKED
+)
+RETURNING webhook_deliveries.id, webhook_deliveries.webhook_id, webhook_deliveries.event, webhook_deliveries.attempts, webhook_deliveries.payload, webhooks.url, webhooks.secret;
+
+-- name: MarkWebhookDelivered :exec
+UPDATE webhook_deliveries
+SET delivered_at = NOW(),
+last_status = $2,
+last_error = NULL
+WHERE id = $1;
+
+-- name: MarkWebhookDeliveryFailed :one
+UPDATE webhook_deliveries
+SET last_status = sqlc.arg(last_status),
+last_error = sqlc.arg(last_error),
+next_attempt_at = NOW() + sqlc.arg(delay_seconds)::int * INTERVAL '1 second',
+failed_at = CASE
+    WHEN attempts >= sqlc.arg(max_attempts)::int THEN NOW()
+    ELSE failed_at
+END
+WHERE id = sqlc.arg(id)
+RETURNING *;
+
+-- name: GetWebhookDeliveriesForUser :many
+SELECT
+    webhook_deliveries.id,
+    webhook_deliveries.created_at,
+    webhook_deliveries.event,
+    webhook_deliveries.attempts,
+    webhook_deliveries.next_attempt_at,
+    webhook_deliveries.delivered_at,
+    webhook_deliveries.failed_at,
+    webhook_deliveries.last_status,
+    webhook_deliveries.last_error,
+    webhooks.url AS webhook_url,
+    posts.title AS post_title
+FROM webhook_deliveries
+JOIN webhooks ON webhooks.id = webhook_deliveries.webhook_id
+JOIN posts ON posts.id = webhook_deliveries.post_id
+WHERE webhooks.user_id = @user_id
+ORDER BY webhook_deliveries.created_at DESC
+LIMIT @max_deliveries;
@@ -0,0 +1,7 @@
+-- +goose Up
+ALTER TABLE feeds ADD COLUMN next_fetch_at TIMESTAMP;
+ALTER TABLE feeds ADD COLUMN fetch_interval_seconds INTEGER NOT NULL DEFAULT 3600;
+
+-- +goose Down
+ALTER TABLE feeds DROP COLUMN fetch_interval_seconds;
+ALTER TABLE feeds DROP COLUMN next_fetch_at;
@@ -0,0 +1,13 @@
+-- +goose Up
+ALTER TABLE posts ADD COLUMN guid TEXT;
+UPDATE posts SET guid = url;
+ALTER TABLE posts ALTER COLUMN guid SET NOT NULL;
+ALTER TABLE posts DROP CONSTRAINT posts_url_key;
+ALTER TABLE posts ADD CONSTRAINT posts_feed_id_guid_key UNIQUE (feed_id, guid);
+
+-- +goose Down
+ALTER TABLE posts DROP CONSTRAINT posts_feed_id_guid_key;
+DELETE FROM posts a USING posts b
+WHERE a.url = b.url AND (a.created_at, a.id) > (b.created_at, b.id);
+ALTER TABLE posts ADD CONSTRAINT posts_url_key UNIQUE (url);
+ALTER TABLE posts DROP COLUMN guid;
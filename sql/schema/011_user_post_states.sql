@@ -0,0 +1,11 @@
+-- +goose Up
+CREATE TABLE user_post_states (
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    post_id UUID NOT NULL REFERENCES posts(id) ON DELETE CASCADE,
+    read BOOLEAN NOT NULL DEFAULT FALSE,
+    read_at TIMESTAMP,
+    PRIMARY KEY (user_id, post_id)
+);
+
+-- +goose Down
+DROP TABLE user_post_states;
@@ -0,0 +1,29 @@
+-- +goose Up
+ALTER TABLE posts ADD COLUMN search tsvector;
+
+-- +goose StatementBegin
+CREATE FUNCTION posts_search_update() RETURNS trigger AS $$
+BEGIN
+    NEW.search :=
+        setweight(to_tsvector('english', coalesce(NEW.title, '')), 'A') ||
+        setweight(to_tsvector('english', coalesce(NEW.description, '')), 'B');
+    RETURN NEW;
+END
+$$ LANGUAGE plpgsql;
+-- +goose StatementEnd
+
+CREATE TRIGGER posts_search_update
+BEFORE INSERT OR UPDATE OF title, description ON posts
+FOR EACH ROW EXECUTE FUNCTION posts_search_update();
+
+UPDATE posts SET search =
+    setweight(to_tsvector('english', coalesce(title, '')), 'A') ||
+    setweight(to_tsvector('english', coalesce(description, '')), 'B');
+
+CREATE INDEX posts_search_idx ON posts USING GIN (search);
+
+-- +goose Down
+DROP INDEX posts_search_idx;
+DROP TRIGGER posts_search_update ON posts;
+DROP FUNCTION posts_search_update();
+ALTER TABLE posts DROP COLUMN search;
@@ -0,0 +1,7 @@
+-- +goose Up
+ALTER TABLE feeds ADD COLUMN max_post_age_seconds INTEGER;
+ALTER TABLE feeds ADD COLUMN max_posts INTEGER;
+
+-- +goose Down
+ALTER TABLE feeds DROP COLUMN max_posts;
+ALTER TABLE feeds DROP COLUMN max_post_age_seconds;
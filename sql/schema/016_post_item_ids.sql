@@ -0,0 +1,8 @@
+-- +goose Up
+-- Sync clients such as Google Reader API readers identify items by a 64-bit
+-- integer rather than a UUID.
+ALTER TABLE posts ADD COLUMN item_id BIGSERIAL;
+CREATE UNIQUE INDEX posts_item_id_idx ON posts (item_id);
+
+-- +goose Down
+ALTER TABLE posts DROP COLUMN item_id;
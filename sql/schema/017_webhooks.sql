@@ -0,0 +1,34 @@
+-- +goose Up
+CREATE TABLE webhooks (
+    id UUID PRIMARY KEY,
+    created_at TIMESTAMP NOT NULL,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    feed_id UUID REFERENCES feeds(id) ON DELETE CASCADE,
+    url TEXT NOT NULL,
+    secret TEXT NOT NULL
+);
+
+CREATE INDEX webhooks_user_id_idx ON webhooks (user_id);
+CREATE INDEX webhooks_feed_id_idx ON webhooks (feed_id);
+
+CREATE TABLE webhook_deliveries (
+    id UUID PRIMARY KEY,
+    created_at TIMESTAMP NOT NULL,
+    webhook_id UUID NOT NULL REFERENCES webhooks(id) ON DELETE CASCADE,
+    post_id UUID NOT NULL REFERENCES posts(id) ON DELETE CASCADE,
+    payload JSONB NOT NULL,
+    attempts INTEGER NOT NULL DEFAULT 0,
+    next_attempt_at TIMESTAMP NOT NULL,
+    delivered_at TIMESTAMP,
+    failed_at TIMESTAMP,
+    last_status INTEGER,
+    last_error TEXT,
+    UNIQUE (webhook_id, post_id)
+);
+
+CREATE INDEX webhook_deliveries_pending_idx ON webhook_deliveries (next_attempt_at)
+WHERE delivered_at IS NULL AND failed_at IS NULL;
+
+-- +goose Down
+DROP TABLE webhook_deliveries;
+DROP TABLE webhooks;
@@ -0,0 +1,24 @@
+-- +goose Up
+CREATE TABLE digest_subscriptions (
+    user_id UUID PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL,
+    email TEXT NOT NULL,
+    frequency TEXT NOT NULL CHECK (frequency IN ('daily', 'weekly'))
+);
+
+CREATE TABLE digests (
+    id UUID PRIMARY KEY,
+    sent_at TIMESTAMP NOT NULL,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    email TEXT NOT NULL,
+    window_start TIMESTAMP NOT NULL,
+    window_end TIMESTAMP NOT NULL,
+    post_count INTEGER NOT NULL
+);
+
+CREATE INDEX digests_user_id_window_end_idx ON digests (user_id, window_end DESC);
+
+-- +goose Down
+DROP TABLE digests;
+DROP TABLE digest_subscriptions;
@@ -0,0 +1,36 @@
+-- +goose Up
+ALTER TABLE posts ADD COLUMN author TEXT;
+
+ALTER TABLE user_post_states ADD COLUMN hidden BOOLEAN NOT NULL DEFAULT FALSE;
+
+CREATE TABLE rules (
+    id UUID PRIMARY KEY,
+    created_at TIMESTAMP NOT NULL,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    field TEXT NOT NULL CHECK (field IN ('title', 'description', 'feed', 'author')),
+    match_type TEXT NOT NULL CHECK (match_type IN ('substring', 'regex', 'word')),
+    pattern TEXT NOT NULL,
+    action TEXT NOT NULL CHECK (action IN ('hide', 'mark-read', 'star', 'notify'))
+);
+
+CREATE INDEX rules_user_id_idx ON rules (user_id);
+
+-- Rules that notify send their own webhook deliveries alongside the
+-- post.created ones, so a post can now be delivered once per event.
+ALTER TABLE webhook_deliveries ADD COLUMN event TEXT NOT NULL DEFAULT 'post.created';
+ALTER TABLE webhook_deliveries DROP CONSTRAINT webhook_deliveries_webhook_id_post_id_key;
+ALTER TABLE webhook_deliveries ADD CONSTRAINT webhook_deliveries_webhook_id_post_id_event_key
+    UNIQUE (webhook_id, post_id, event);
+
+-- +goose Down
+DELETE FROM webhook_deliveries WHERE event <> 'post.created';
+ALTER TABLE webhook_deliveries DROP CONSTRAINT webhook_deliveries_webhook_id_post_id_event_key;
+ALTER TABLE webhook_deliveries ADD CONSTRAINT webhook_deliveries_webhook_id_post_id_key
+    UNIQUE (webhook_id, post_id);
+ALTER TABLE webhook_deliveries DROP COLUMN event;
+
+DROP TABLE rules;
+
+ALTER TABLE user_post_states DROP COLUMN hidden;
+
+ALTER TABLE posts DROP COLUMN author;
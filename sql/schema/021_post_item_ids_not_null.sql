@@ -0,0 +1,7 @@
+-- +goose Up
+-- BIGSERIAL already fills every row, but declaring it lets sqlc generate a
+-- plain int64 for item_id.
+ALTER TABLE posts ALTER COLUMN item_id SET NOT NULL;
+
+-- +goose Down
+ALTER TABLE posts ALTER COLUMN item_id DROP NOT NULL;
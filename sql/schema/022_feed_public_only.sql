@@ -0,0 +1,7 @@
+-- +goose Up
+-- Feeds added through the API or web interface name URLs chosen by remote
+-- callers, so they're only ever fetched from public addresses.
+ALTER TABLE feeds ADD COLUMN public_only BOOLEAN NOT NULL DEFAULT FALSE;
+
+-- +goose Down
+ALTER TABLE feeds DROP COLUMN public_only;
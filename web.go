@@ -0,0 +1,462 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"database/sql"
+	"embed"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"html"
+	"html/template"
+	"log"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/VuTLy/blogAggregator/internal/database"
+	"github.com/google/uuid"
+)
+
+const (
+	sessionCookieName = "gator_session"
+	sessionLifetime   = 30 * 24 * time.Hour
+)
+
+//go:embed templates/*.html
+var templateFS embed.FS
+
+var webTemplates = parseWebTemplates()
+
+var webSessions = &sessionStore{sessions: map[string]webSession{}}
+
+// parseWebTemplates parses each page together with the shared layout, keyed
+// by page name.
+func parseWebTemplates() map[string]*template.Template {
+	funcs := template.FuncMap{
+		"date":    formatWebDate,
+		"excerpt": excerpt,
+	}
+	pages := map[string]*template.Template{}
+	for _, page := range []string{"login", "timeline", "feeds", "feed", "addfeed"} {
+		pages[page] = template.Must(template.New(page).Funcs(funcs).ParseFS(templateFS, "templates/layout.html", "templates/"+page+".html"))
+	}
+	return pages
+}
+
+// webPage is the data every page template is rendered with. Pages use the
+// fields they need and leave the rest empty.
+type webPage struct {
+	Title   string
+	User    *database.User
+	Error   string
+	Form    map[string]string
+	Posts   []database.GetPostsForUserRow
+	Feeds   []webFeed
+	MoreURL string
+}
+
+type webFeed struct {
+	Feed      database.Feed
+	Following bool
+	// Next is where the follow button returns to.
+	Next string
+}
+
+type webSession struct {
+	UserID    uuid.UUID
+	ExpiresAt time.Time
+}
+
+// sessionStore keeps web logins in memory, so restarting serve logs everyone
+// out.
+type sessionStore struct {
+	mu       sync.Mutex
+	sessions map[string]webSession
+}
+
+func (st *sessionStore) create(userID uuid.UUID) (string, error) {
+	secret := make([]byte, 32)
+	_, err := rand.Read(secret)
+	if err != nil {
+		return "", fmt.Errorf("couldn't generate session token: %w", err)
+	}
+	token := hex.EncodeToString(secret)
+
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	st.sessions[token] = webSession{
+		UserID:    userID,
+		ExpiresAt: time.Now().Add(sessionLifetime),
+	}
+	return token, nil
+}
+
+func (st *sessionStore) get(token string) (uuid.UUID, bool) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	session, ok := st.sessions[token]
+	if !ok {
+		return uuid.Nil, false
+	}
+	if time.Now().After(session.ExpiresAt) {
+		delete(st.sessions, token)
+		return uuid.Nil, false
+	}
+	return session.UserID, true
+}
+
+func (st *sessionStore) delete(token string) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	delete(st.sessions, token)
+}
+
+func registerWebRoutes(handle func(pattern string, handler apiHandler)) {
+	handle("GET /{$}", webMiddlewareSession(webTimeline))
+	handle("GET /login", webLoginForm)
+	handle("POST /login", webLogin)
+	handle("POST /logout", webLogout)
+	handle("GET /feeds", webMiddlewareSession(webFeeds))
+	handle("GET /feeds/new", webMiddlewareSession(webAddFeedForm))
+	handle("POST /feeds", webMiddlewareSession(webAddFeed))
+	handle("GET /feeds/{feedID}", webMiddlewareSession(webFeedPage))
+	handle("POST /feeds/{feedID}/follow", webMiddlewareSession(webFollow))
+	handle("POST /feeds/{feedID}/unfollow", webMiddlewareSession(webUnfollow))
+}
+
+// webMiddlewareSession is the web UI's middlewareLoggedIn: it resolves the
+// user from the session cookie and sends visitors without one to the login
+// page.
+func webMiddlewareSession(handler func(s *state, w http.ResponseWriter, r *http.Request, user database.User)) apiHandler {
+	return func(s *state, w http.ResponseWriter, r *http.Request) {
+		cookie, err := r.Cookie(sessionCookieName)
+		if err != nil {
+			http.Redirect(w, r, "/login", http.StatusSeeOther)
+			return
+		}
+		userID, ok := webSessions.get(cookie.Value)
+		if !ok {
+			http.Redirect(w, r, "/login", http.StatusSeeOther)
+			return
+		}
+
+		user, err := s.db.GetUserById(r.Context(), userID)
+		if errors.Is(err, sql.ErrNoRows) {
+			webSessions.delete(cookie.Value)
+			http.Redirect(w, r, "/login", http.StatusSeeOther)
+			return
+		}
+		if err != nil {
+			renderWebError(w, "couldn't get user", err)
+			return
+		}
+
+		handler(s, w, r, user)
+	}
+}
+
+func webLoginForm(s *state, w http.ResponseWriter, r *http.Request) {
+	renderPage(w, http.StatusOK, "login", webPage{Title: "Log in"})
+}
+
+// webLogin signs a user in with one of their API keys, the same credential
+// the API and sync clients use.
+func webLogin(s *state, w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimSpace(r.FormValue("name"))
+	page := webPage{
+		Title: "Log in",
+		Form:  map[string]string{"name": name},
+	}
+
+	user, err := s.db.GetUserByAPIKey(r.Context(), hashAPIKey(strings.TrimSpace(r.FormValue("key"))))
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && user.Name != name) {
+		page.Error = "Wrong user name or API key."
+		renderPage(w, http.StatusUnauthorized, "login", page)
+		return
+	}
+	if err != nil {
+		renderWebError(w, "couldn't get user", err)
+		return
+	}
+
+	token, err := webSessions.create(user.ID)
+	if err != nil {
+		renderWebError(w, "couldn't log in", err)
+		return
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookieName,
+		Value:    token,
+		Path:     "/",
+		MaxAge:   int(sessionLifetime.Seconds()),
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+	})
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
+
+func webLogout(s *state, w http.ResponseWriter, r *http.Request) {
+	if cookie, err := r.Cookie(sessionCookieName); err == nil {
+		webSessions.delete(cookie.Value)
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:   sessionCookieName,
+		Path:   "/",
+		MaxAge: -1,
+	})
+	http.Redirect(w, r, "/login", http.StatusSeeOther)
+}
+
+func webTimeline(s *state, w http.ResponseWriter, r *http.Request, user database.User) {
+	limit := defaultTimelineSize
+	if n, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil && n > 0 {
+		limit = min(n, 1000)
+	}
+
+	posts, err := s.db.GetPostsForUser(r.Context(), database.GetPostsForUserParams{
+		UserID: user.ID,
+		Limit:  int32(limit),
+	})
+	if err != nil {
+		renderWebError(w, "couldn't get posts", err)
+		return
+	}
+
+	page := webPage{
+		Title: "Timeline",
+		User:  &user,
+		Posts: posts,
+	}
+	if len(posts) == limit {
+		page.MoreURL = fmt.Sprintf("/?limit=%d", limit+defaultTimelineSize)
+	}
+	renderPage(w, http.StatusOK, "timeline", page)
+}
+
+func webFeeds(s *state, w http.ResponseWriter, r *http.Request, user database.User) {
+	feeds, err := s.db.GetFeeds(r.Context())
+	if err != nil {
+		renderWebError(w, "couldn't get feeds", err)
+		return
+	}
+	following, err := followedFeedIDs(r, s.db, user)
+	if err != nil {
+		renderWebError(w, "couldn't get feed follows", err)
+		return
+	}
+
+	page := webPage{
+		Title: "Feeds",
+		User:  &user,
+	}
+	for _, feed := range feeds {
+		page.Feeds = append(page.Feeds, webFeed{
+			Feed:      feed,
+			Following: following[feed.ID],
+			Next:      "/feeds",
+		})
+	}
+	renderPage(w, http.StatusOK, "feeds", page)
+}
+
+func webFeedPage(s *state, w http.ResponseWriter, r *http.Request, user database.User) {
+	feedID, err := uuid.Parse(r.PathValue("feedID"))
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	feed, err := s.db.GetFeedByID(r.Context(), feedID)
+	if errors.Is(err, sql.ErrNoRows) {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		renderWebError(w, "couldn't get feed", err)
+		return
+	}
+
+	following, err := followedFeedIDs(r, s.db, user)
+	if err != nil {
+		renderWebError(w, "couldn't get feed follows", err)
+		return
+	}
+	rows, err := s.db.GetPostsForFeed(r.Context(), database.GetPostsForFeedParams{
+		FeedID: feed.ID,
+		Limit:  defaultTimelineSize,
+		UserID: user.ID,
+	})
+	if err != nil {
+		renderWebError(w, "couldn't get posts", err)
+		return
+	}
+
+	page := webPage{
+		Title: feed.Name,
+		User:  &user,
+		Feeds: []webFeed{{
+			Feed:      feed,
+			Following: following[feed.ID],
+			Next:      r.URL.Path,
+		}},
+	}
+	for _, row := range rows {
+		page.Posts = append(page.Posts, database.GetPostsForUserRow(row))
+	}
+	renderPage(w, http.StatusOK, "feed", page)
+}
+
+func webAddFeedForm(s *state, w http.ResponseWriter, r *http.Request, user database.User) {
+	renderPage(w, http.StatusOK, "addfeed", webPage{
+		Title: "Add a feed",
+		User:  &user,
+	})
+}
+
+func webAddFeed(s *state, w http.ResponseWriter, r *http.Request, user database.User) {
+	name := strings.TrimSpace(r.FormValue("name"))
+	pageURL := strings.TrimSpace(r.FormValue("url"))
+	page := webPage{
+		Title: "Add a feed",
+		User:  &user,
+		Form: map[string]string{
+			"name": name,
+			"url":  pageURL,
+		},
+	}
+	if name == "" || pageURL == "" {
+		page.Error = "Both a name and a URL are needed."
+		renderPage(w, http.StatusUnprocessableEntity, "addfeed", page)
+		return
+	}
+
+	candidates, err := discoverFeeds(r.Context(), publicHTTPClient, pageURL)
+	if err != nil {
+		page.Error = fmt.Sprintf("Couldn't find a feed at %s: %v", pageURL, err)
+		renderPage(w, http.StatusUnprocessableEntity, "addfeed", page)
+		return
+	}
+
+	feed, _, err := addFeed(r.Context(), s.db, user, name, candidates[0].URL, true)
+	if isUniqueViolation(err) {
+		page.Error = "That feed has already been added; follow it from the feed list."
+		renderPage(w, http.StatusConflict, "addfeed", page)
+		return
+	}
+	if err != nil {
+		renderWebError(w, "couldn't add feed", err)
+		return
+	}
+
+	http.Redirect(w, r, "/feeds/"+feed.ID.String(), http.StatusSeeOther)
+}
+
+func webFollow(s *state, w http.ResponseWriter, r *http.Request, user database.User) {
+	feedID, err := uuid.Parse(r.PathValue("feedID"))
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	_, err = s.db.CreateFeedFollow(r.Context(), database.CreateFeedFollowParams{
+		ID:        uuid.New(),
+		CreatedAt: time.Now().UTC(),
+		UpdatedAt: time.Now().UTC(),
+		UserID:    user.ID,
+		FeedID:    feedID,
+	})
+	if err != nil && !isUniqueViolation(err) {
+		renderWebError(w, "couldn't follow feed", err)
+		return
+	}
+	_, err = hideMatchingPosts(r.Context(), s.db, user, uuid.NullUUID{UUID: feedID, Valid: true})
+	if err != nil {
+		renderWebError(w, "couldn't apply hide rules", err)
+		return
+	}
+
+	http.Redirect(w, r, localRedirect(r.FormValue("next"), "/feeds"), http.StatusSeeOther)
+}
+
+func webUnfollow(s *state, w http.ResponseWriter, r *http.Request, user database.User) {
+	feedID, err := uuid.Parse(r.PathValue("feedID"))
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	_, err = s.db.DeleteFeedFollow(r.Context(), database.DeleteFeedFollowParams{
+		FeedID: feedID,
+		UserID: user.ID,
+	})
+	if err != nil {
+		renderWebError(w, "couldn't unfollow feed", err)
+		return
+	}
+
+	http.Redirect(w, r, localRedirect(r.FormValue("next"), "/feeds"), http.StatusSeeOther)
+}
+
+func followedFeedIDs(r *http.Request, db *database.Queries, user database.User) (map[uuid.UUID]bool, error) {
+	feedFollows, err := db.GetFeedFollowsForUser(r.Context(), user.ID)
+	if err != nil {
+		return nil, err
+	}
+	following := map[uuid.UUID]bool{}
+	for _, ff := range feedFollows {
+		following[ff.FeedID] = true
+	}
+	return following, nil
+}
+
+// localRedirect returns next if it's a path on this site, and fallback
+// otherwise, so a form can't be used to redirect elsewhere.
+func localRedirect(next, fallback string) string {
+	if !strings.HasPrefix(next, "/") || strings.HasPrefix(next, "//") || strings.HasPrefix(next, "/\\") {
+		return fallback
+	}
+	return next
+}
+
+func renderPage(w http.ResponseWriter, code int, name string, page webPage) {
+	var buf bytes.Buffer
+	err := webTemplates[name].ExecuteTemplate(&buf, "layout", page)
+	if err != nil {
+		log.Printf("Couldn't render %s page: %v", name, err)
+		http.Error(w, "couldn't render page", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(code)
+	buf.WriteTo(w)
+}
+
+func renderWebError(w http.ResponseWriter, msg string, err error) {
+	log.Printf("%s: %v", msg, err)
+	http.Error(w, msg, http.StatusInternalServerError)
+}
+
+func formatWebDate(t sql.NullTime) string {
+	if !t.Valid {
+		return ""
+	}
+	return t.Time.Format("Jan 2, 2006")
+}
+
+var tagPattern = regexp.MustCompile(`(?s)<[^>]*>`)
+
+// excerpt turns a post's HTML description into a short plain-text summary.
+// The template escapes the result, so feed markup never reaches the page.
+func excerpt(description sql.NullString) string {
+	text := html.UnescapeString(tagPattern.ReplaceAllString(description.String, " "))
+	text = strings.Join(strings.Fields(text), " ")
+	if runes := []rune(text); len(runes) > 300 {
+		text = strings.TrimSpace(string(runes[:300])) + "…"
+	}
+	return text
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestWebLoginRequiresAPIKey(t *testing.T) {
+	router, queries, user, key := newTestAPI(t)
+	other := createTestUser(t, queries, "bob")
+	otherKey, _, err := createAPIKey(context.Background(), queries, other, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		form     url.Values
+		wantCode int
+	}{
+		{"name only", url.Values{"name": {user.Name}}, http.StatusUnauthorized},
+		{"wrong key", url.Values{"name": {user.Name}, "key": {apiKeyPrefix + "nope"}}, http.StatusUnauthorized},
+		{"someone else's key", url.Values{"name": {user.Name}, "key": {otherKey}}, http.StatusUnauthorized},
+		{"own key", url.Values{"name": {user.Name}, "key": {key}}, http.StatusSeeOther},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest("POST", "/login", strings.NewReader(tt.form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+
+		if rec.Code != tt.wantCode {
+			t.Errorf("%s: status %d, want %d", tt.name, rec.Code, tt.wantCode)
+		}
+		gotSession := false
+		for _, cookie := range rec.Result().Cookies() {
+			if cookie.Name == sessionCookieName && cookie.Value != "" {
+				gotSession = true
+			}
+		}
+		if gotSession != (tt.wantCode == http.StatusSeeOther) {
+			t.Errorf("%s: session cookie set = %t", tt.name, gotSession)
+		}
+	}
+}
@@ -0,0 +1,428 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/VuTLy/blogAggregator/internal/database"
+	"github.com/google/uuid"
+)
+
+const (
+	// webhookTimeout bounds a single delivery attempt.
+	webhookTimeout = 10 * time.Second
+	// webhookLease is how long a claimed delivery is hidden from other
+	// dispatchers. It must outlast webhookTimeout, so a delivery is only
+	// retried by someone else if its dispatcher died mid-attempt.
+	webhookLease = 5 * time.Minute
+
+	maxWebhookAttempts = 8
+	minWebhookBackoff  = 30 * time.Second
+	maxWebhookBackoff  = 6 * time.Hour
+
+	webhookBatchSize = 20
+)
+
+// webhookHTTPClient sends webhook deliveries. Like publicHTTPClient it only
+// connects to public addresses, so a webhook can't be pointed at services
+// on the machine or network agg runs on.
+var webhookHTTPClient = &http.Client{
+	Timeout:   webhookTimeout,
+	Transport: newPublicTransport(),
+}
+
+// webhookPayload is the JSON body POSTed to webhooks. It's signed with the
+// webhook's secret: X-Gator-Signature is "sha256=" followed by the hex
+// HMAC-SHA256 of the body. Event is post.created for new posts, or
+// rule.matched when one of the user's notify rules matched the post, in
+// which case Rule is set.
+type webhookPayload struct {
+	Event string       `json:"event"`
+	Post  apiPost      `json:"post"`
+	Feed  webhookFeed  `json:"feed"`
+	Rule  *webhookRule `json:"rule,omitempty"`
+}
+
+type webhookFeed struct {
+	ID   uuid.UUID `json:"id"`
+	Name string    `json:"name"`
+	URL  string    `json:"url"`
+}
+
+type webhookRule struct {
+	ID      uuid.UUID `json:"id"`
+	Field   string    `json:"field"`
+	Match   string    `json:"match"`
+	Pattern string    `json:"pattern"`
+	Action  string    `json:"action"`
+}
+
+func handlerWebhook(s *state, cmd command, user database.User) error {
+	usage := fmt.Errorf("usage: %s add <url> [--feed feed_url] [--secret s] | list | remove <id|url> | log [--limit n]", cmd.Name)
+	if len(cmd.Args) == 0 {
+		return usage
+	}
+
+	sub := command{Name: cmd.Name + " " + cmd.Args[0], Args: cmd.Args[1:]}
+	switch cmd.Args[0] {
+	case "add":
+		return handlerWebhookAdd(s, sub, user)
+	case "list":
+		return handlerWebhookList(s, sub, user)
+	case "remove":
+		return handlerWebhookRemove(s, sub, user)
+	case "log":
+		return handlerWebhookLog(s, sub, user)
+	default:
+		return usage
+	}
+}
+
+func handlerWebhookAdd(s *state, cmd command, user database.User) error {
+	fs := flag.NewFlagSet(cmd.Name, flag.ContinueOnError)
+	feedURL := fs.String("feed", "", "only send posts from this feed instead of every feed you follow")
+	secret := fs.String("secret", "", "secret to sign payloads with (generated if empty)")
+	args, err := parseFlags(fs, cmd.Args)
+	if err != nil {
+		return err
+	}
+	if len(args) != 1 {
+		return fmt.Errorf("usage: %s <url> [--feed feed_url] [--secret s]", cmd.Name)
+	}
+
+	target, err := url.Parse(args[0])
+	if err != nil || (target.Scheme != "http" && target.Scheme != "https") || target.Host == "" {
+		return fmt.Errorf("invalid webhook URL %q: must be an http or https URL", args[0])
+	}
+	err = checkPublicHost(context.Background(), target.Hostname())
+	if err != nil {
+		return fmt.Errorf("invalid webhook URL %q: %w", args[0], err)
+	}
+
+	feedID := uuid.NullUUID{}
+	if *feedURL != "" {
+		feed, err := s.db.GetFeedByURL(context.Background(), *feedURL)
+		if err != nil {
+			return fmt.Errorf("couldn't get feed: %w", err)
+		}
+		feedID = uuid.NullUUID{
+			UUID:  feed.ID,
+			Valid: true,
+		}
+	}
+
+	if *secret == "" {
+		buf := make([]byte, 32)
+		_, err := rand.Read(buf)
+		if err != nil {
+			return fmt.Errorf("couldn't generate secret: %w", err)
+		}
+		*secret = hex.EncodeToString(buf)
+	}
+
+	webhook, err := s.db.CreateWebhook(context.Background(), database.CreateWebhookParams{
+		ID:        uuid.New(),
+		CreatedAt: time.Now().UTC(),
+		UserID:    user.ID,
+		FeedID:    feedID,
+		Url:       target.String(),
+		Secret:    *secret,
+	})
+	if err != nil {
+		return fmt.Errorf("couldn't create webhook: %w", err)
+	}
+
+	scope := "every feed you follow"
+	if *feedURL != "" {
+		scope = *feedURL
+	}
+	fmt.Printf("Added webhook %s for new posts from %s:\n", webhook.ID, scope)
+	fmt.Printf("* URL:    %s\n", webhook.Url)
+	fmt.Printf("* Secret: %s\n", webhook.Secret)
+	fmt.Println("Payloads are signed with the secret in the X-Gator-Signature header. Deliveries are sent while agg is running.")
+	return nil
+}
+
+func handlerWebhookList(s *state, cmd command, user database.User) error {
+	if len(cmd.Args) != 0 {
+		return fmt.Errorf("usage: %s", cmd.Name)
+	}
+
+	webhooks, err := s.db.GetWebhooksForUser(context.Background(), user.ID)
+	if err != nil {
+		return fmt.Errorf("couldn't get webhooks: %w", err)
+	}
+
+	if len(webhooks) == 0 {
+		fmt.Println("No webhooks found.")
+		return nil
+	}
+
+	fmt.Printf("Found %d webhooks for %s:\n", len(webhooks), user.Name)
+	for _, webhook := range webhooks {
+		scope := "all followed feeds"
+		if webhook.FeedUrl.Valid {
+			scope = webhook.FeedUrl.String
+		}
+		fmt.Printf("* %s  %s (%s)\n", webhook.ID, webhook.Url, scope)
+	}
+	return nil
+}
+
+func handlerWebhookRemove(s *state, cmd command, user database.User) error {
+	if len(cmd.Args) != 1 {
+		return fmt.Errorf("usage: %s <id|url>", cmd.Name)
+	}
+
+	count, err := s.db.DeleteWebhook(context.Background(), database.DeleteWebhookParams{
+		UserID:  user.ID,
+		Webhook: cmd.Args[0],
+	})
+	if err != nil {
+		return fmt.Errorf("couldn't remove webhook: %w", err)
+	}
+	if count == 0 {
+		return fmt.Errorf("no webhook matches %s", cmd.Args[0])
+	}
+
+	fmt.Printf("Removed %d webhooks.\n", count)
+	return nil
+}
+
+func handlerWebhookLog(s *state, cmd command, user database.User) error {
+	fs := flag.NewFlagSet(cmd.Name, flag.ContinueOnError)
+	limit := fs.Int("limit", 20, "number of deliveries to show")
+	args, err := parseFlags(fs, cmd.Args)
+	if err != nil {
+		return err
+	}
+	if len(args) != 0 {
+		return fmt.Errorf("usage: %s [--limit n]", cmd.Name)
+	}
+
+	deliveries, err := s.db.GetWebhookDeliveriesForUser(context.Background(), database.GetWebhookDeliveriesForUserParams{
+		UserID:        user.ID,
+		MaxDeliveries: int32(*limit),
+	})
+	if err != nil {
+		return fmt.Errorf("couldn't get webhook deliveries: %w", err)
+	}
+
+	if len(deliveries) == 0 {
+		fmt.Println("No webhook deliveries found.")
+		return nil
+	}
+
+	for _, delivery := range deliveries {
+		var status string
+		switch {
+		case delivery.DeliveredAt.Valid:
+			status = fmt.Sprintf("delivered %v", delivery.DeliveredAt.Time.Format(time.DateTime))
+		case delivery.FailedAt.Valid:
+			status = fmt.Sprintf("gave up %v", delivery.FailedAt.Time.Format(time.DateTime))
+		case delivery.Attempts == 0:
+			status = "pending"
+		default:
+			status = fmt.Sprintf("retrying %v", delivery.NextAttemptAt.Format(time.DateTime))
+		}
+
+		fmt.Printf("* %v %s %s -> %s\n", delivery.CreatedAt.Format(time.DateTime), delivery.Event, delivery.PostTitle, delivery.WebhookUrl)
+		fmt.Printf("  %s after %d attempts", status, delivery.Attempts)
+		if delivery.LastStatus.Valid {
+			fmt.Printf(", last status %d", delivery.LastStatus.Int32)
+		}
+		if delivery.LastError.Valid && !delivery.DeliveredAt.Valid {
+			fmt.Printf(", last error: %s", delivery.LastError.String)
+		}
+		fmt.Println()
+	}
+	return nil
+}
+
+// enqueueWebhooks queues a delivery of a new post to every webhook that
+// covers its feed. The dispatcher in agg sends them.
+func enqueueWebhooks(ctx context.Context, db *database.Queries, feed database.Feed, post database.Post) error {
+	payload, err := json.Marshal(newWebhookPayload("post.created", feed, post))
+	if err != nil {
+		return fmt.Errorf("couldn't encode webhook payload: %w", err)
+	}
+
+	_, err = db.EnqueueWebhookDeliveries(ctx, database.EnqueueWebhookDeliveriesParams{
+		PostID:  post.ID,
+		Payload: payload,
+		FeedID:  feed.ID,
+	})
+	if err != nil {
+		return fmt.Errorf("couldn't queue webhooks: %w", err)
+	}
+	return nil
+}
+
+func newWebhookPayload(event string, feed database.Feed, post database.Post) webhookPayload {
+	return webhookPayload{
+		Event: event,
+		Post: apiPost{
+			ID:          post.ID,
+			CreatedAt:   post.CreatedAt,
+			UpdatedAt:   post.UpdatedAt,
+			Title:       post.Title,
+			URL:         post.Url,
+			Description: nullStringPtr(post.Description),
+			PublishedAt: nullTimePtr(post.PublishedAt),
+			FeedID:      feed.ID,
+			FeedName:    feed.Name,
+		},
+		Feed: webhookFeed{
+			ID:   feed.ID,
+			Name: feed.Name,
+			URL:  feed.Url,
+		},
+	}
+}
+
+// runWebhookDispatcher sends queued webhook deliveries every interval until
+// ctx is cancelled. Deliveries already claimed finish on workCtx.
+func runWebhookDispatcher(ctx, workCtx context.Context, db *database.Queries, stats *aggStats, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		dispatchWebhooks(ctx, workCtx, db, webhookHTTPClient, stats)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// dispatchWebhooks claims due deliveries a batch at a time and sends them
+// until none are left. Claiming skips rows another dispatcher has locked and
+// leases the rest for webhookLease, so several agg processes can share the
+// queue without sending a payload twice.
+func dispatchWebhooks(ctx, workCtx context.Context, db *database.Queries, client *http.Client, stats *aggStats) {
+	for ctx.Err() == nil {
+		deliveries, err := db.ClaimWebhookDeliveries(ctx, database.ClaimWebhookDeliveriesParams{
+			LeaseSeconds:  int32(webhookLease.Seconds()),
+			MaxDeliveries: webhookBatchSize,
+		})
+		if err != nil {
+			if ctx.Err() == nil {
+				log.Printf("Couldn't claim webhook deliveries: %v", err)
+			}
+			return
+		}
+
+		for _, delivery := range deliveries {
+			status, err := sendWebhook(workCtx, client, delivery)
+			stats.recordWebhook(err == nil)
+			if err == nil {
+				err = db.MarkWebhookDelivered(workCtx, database.MarkWebhookDeliveredParams{
+					ID: delivery.ID,
+					LastStatus: sql.NullInt32{
+						Int32: int32(status),
+						Valid: true,
+					},
+				})
+				if err != nil {
+					log.Printf("Couldn't mark webhook delivery %s delivered: %v", delivery.ID, err)
+				}
+				continue
+			}
+			markWebhookFailed(workCtx, db, delivery, status, err)
+		}
+
+		if len(deliveries) < webhookBatchSize {
+			return
+		}
+	}
+}
+
+// sendWebhook POSTs a delivery's signed payload and returns the response
+// status, which is 0 if there was no response. Anything but a 2xx is an
+// error.
+func sendWebhook(ctx context.Context, client *http.Client, delivery database.ClaimWebhookDeliveriesRow) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, "POST", delivery.Url, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "gator")
+	req.Header.Set("X-Gator-Event", delivery.Event)
+	req.Header.Set("X-Gator-Delivery", delivery.ID.String())
+	req.Header.Set("X-Gator-Signature", signWebhook(delivery.Secret, delivery.Payload))
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return resp.StatusCode, nil
+}
+
+// signWebhook is the X-Gator-Signature header for a payload. Receivers
+// should compute the same HMAC over the raw body and compare in constant
+// time.
+func signWebhook(secret string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(payload)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// markWebhookFailed records a failed attempt and schedules a retry, giving
+// up after maxWebhookAttempts.
+func markWebhookFailed(ctx context.Context, db *database.Queries, delivery database.ClaimWebhookDeliveriesRow, status int, deliveryErr error) {
+	backoff := webhookBackoff(delivery.Attempts)
+	updated, err := db.MarkWebhookDeliveryFailed(ctx, database.MarkWebhookDeliveryFailedParams{
+		LastStatus: sql.NullInt32{
+			Int32: int32(status),
+			Valid: status != 0,
+		},
+		LastError: sql.NullString{
+			String: deliveryErr.Error(),
+			Valid:  true,
+		},
+		DelaySeconds: int32(backoff.Seconds()),
+		MaxAttempts:  maxWebhookAttempts,
+		ID:           delivery.ID,
+	})
+	if err != nil {
+		log.Printf("Couldn't mark webhook delivery %s failed: %v", delivery.ID, err)
+		return
+	}
+
+	if updated.FailedAt.Valid {
+		log.Printf("Giving up on webhook delivery %s to %s after %d attempts: %v", delivery.ID, delivery.Url, updated.Attempts, deliveryErr)
+		return
+	}
+	log.Printf("Webhook delivery %s to %s failed (%v), retrying in %s", delivery.ID, delivery.Url, deliveryErr, backoff)
+}
+
+// webhookBackoff doubles the wait after each failed attempt, from
+// minWebhookBackoff up to maxWebhookBackoff.
+func webhookBackoff(attempts int32) time.Duration {
+	backoff := minWebhookBackoff
+	for i := int32(1); i < attempts && backoff < maxWebhookBackoff; i++ {
+		backoff *= 2
+	}
+	return min(backoff, maxWebhookBackoff)
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/VuTLy/blogAggregator/internal/database"
+	"github.com/google/uuid"
+)
+
+func TestWebhookBackoff(t *testing.T) {
+	tests := []struct {
+		attempts int32
+		want     time.Duration
+	}{
+		{1, 30 * time.Second},
+		{2, time.Minute},
+		{3, 2 * time.Minute},
+		{8, 64 * time.Minute},
+		{10, 256 * time.Minute},
+		{11, 6 * time.Hour},
+		{100, 6 * time.Hour},
+	}
+	for _, tt := range tests {
+		if got := webhookBackoff(tt.attempts); got != tt.want {
+			t.Errorf("webhookBackoff(%d) = %s, want %s", tt.attempts, got, tt.want)
+		}
+	}
+}
+
+func TestHandlerWebhookAddRejectsPrivateHosts(t *testing.T) {
+	s := &state{}
+	for _, target := range []string{
+		"http://localhost:8080/hook",
+		"http://127.0.0.1/hook",
+		"https://[::1]/hook",
+		"http://10.0.0.5/hook",
+		"http://169.254.169.254/latest/meta-data/",
+	} {
+		err := handlerWebhookAdd(s, command{Name: "webhook add", Args: []string{target}}, database.User{})
+		if !errors.Is(err, errPrivateAddress) {
+			t.Errorf("webhook add %s: got %v, want %v", target, err, errPrivateAddress)
+		}
+	}
+}
+
+func TestDispatchWebhooks(t *testing.T) {
+	db, queries := testDB(t)
+	ctx := context.Background()
+	user := createTestUser(t, queries, "alice")
+
+	// The receiver checks each delivery's signature and fails the first
+	// one, so the dispatcher has to retry.
+	const secret = "s3cret"
+	var mu sync.Mutex
+	var received []webhookPayload
+	requests := 0
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			t.Errorf("couldn't read delivery: %v", err)
+			return
+		}
+		mac := hmac.New(sha256.New, []byte(secret))
+		mac.Write(body)
+		if want := "sha256=" + hex.EncodeToString(mac.Sum(nil)); r.Header.Get("X-Gator-Signature") != want {
+			t.Errorf("X-Gator-Signature = %q, want %q", r.Header.Get("X-Gator-Signature"), want)
+		}
+		if r.Header.Get("X-Gator-Event") != "post.created" {
+			t.Errorf("X-Gator-Event = %q, want post.created", r.Header.Get("X-Gator-Event"))
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		requests++
+		if requests == 1 {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		var payload webhookPayload
+		err = json.Unmarshal(body, &payload)
+		if err != nil {
+			t.Errorf("invalid payload: %v", err)
+		}
+		received = append(received, payload)
+	}))
+	defer receiver.Close()
+	countRequests := func() int {
+		mu.Lock()
+		defer mu.Unlock()
+		return requests
+	}
+
+	source := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/rss+xml")
+		fmt.Fprint(w, `<?xml version="1.0"?>
+<rss version="2.0"><channel><title>Blog</title>
+<item><title>Hello</title><link>https://blog.example.com/hello</link><description>Hi</description></item>
+</channel></rss>`)
+	}))
+	defer source.Close()
+	feed := createTestFeed(t, queries, user, source.URL)
+	_, err := queries.CreateWebhook(ctx, database.CreateWebhookParams{
+		ID:        uuid.New(),
+		CreatedAt: time.Now().UTC(),
+		UserID:    user.ID,
+		FeedID:    uuid.NullUUID{UUID: feed.ID, Valid: true},
+		Url:       receiver.URL,
+		Secret:    secret,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Saving the new post queues its delivery.
+	result := scrapeFeed(ctx, db, queries, feed, 10)
+	if result.Err != nil || result.NewPosts != 1 {
+		t.Fatalf("scrapeFeed: %d new posts, err %v", result.NewPosts, result.Err)
+	}
+
+	type delivery struct {
+		attempts    int
+		lastStatus  int
+		delivered   bool
+		waitSeconds float64
+	}
+	getDelivery := func() delivery {
+		t.Helper()
+		var d delivery
+		err := db.QueryRow(`SELECT attempts, COALESCE(last_status, 0), delivered_at IS NOT NULL,
+			EXTRACT(EPOCH FROM next_attempt_at - NOW()::timestamp)::float8
+			FROM webhook_deliveries`).Scan(&d.attempts, &d.lastStatus, &d.delivered, &d.waitSeconds)
+		if err != nil {
+			t.Fatalf("couldn't get delivery: %v", err)
+		}
+		return d
+	}
+
+	stats := &aggStats{}
+	dispatchWebhooks(ctx, ctx, queries, receiver.Client(), stats)
+	d := getDelivery()
+	if d.attempts != 1 || d.lastStatus != http.StatusInternalServerError || d.delivered {
+		t.Fatalf("after a failed attempt got %+v", d)
+	}
+	if backoff := webhookBackoff(1).Seconds(); d.waitSeconds < backoff-5 || d.waitSeconds > backoff+5 {
+		t.Errorf("retry in %.0fs, want %.0fs", d.waitSeconds, backoff)
+	}
+
+	// Nothing is sent again until the backoff has passed.
+	dispatchWebhooks(ctx, ctx, queries, receiver.Client(), stats)
+	if n := countRequests(); n != 1 {
+		t.Fatalf("receiver got %d requests before the retry was due, want 1", n)
+	}
+
+	_, err = db.Exec(`UPDATE webhook_deliveries SET next_attempt_at = NOW()`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dispatchWebhooks(ctx, ctx, queries, receiver.Client(), stats)
+	d = getDelivery()
+	if d.attempts != 2 || d.lastStatus != http.StatusOK || !d.delivered {
+		t.Errorf("after a successful attempt got %+v", d)
+	}
+	mu.Lock()
+	if len(received) != 1 || received[0].Post.Title != "Hello" || received[0].Feed.ID != feed.ID {
+		t.Errorf("receiver got %+v", received)
+	}
+	mu.Unlock()
+	if stats.webhooksSent != 1 || stats.webhooksFailed != 1 {
+		t.Errorf("stats counted %d sent and %d failed, want 1 and 1", stats.webhooksSent, stats.webhooksFailed)
+	}
+
+	// A delivered webhook is never sent again.
+	_, err = db.Exec(`UPDATE webhook_deliveries SET next_attempt_at = NOW()`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dispatchWebhooks(ctx, ctx, queries, receiver.Client(), stats)
+	if n := countRequests(); n != 2 {
+		t.Errorf("receiver got %d requests, want 2", n)
+	}
+}